@@ -2,55 +2,165 @@ package bunadapter
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/casbin/casbin/v2/model"
 	"github.com/casbin/casbin/v2/persist"
 	"github.com/mmcloughlin/meow"
 	"github.com/uptrace/bun"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// Filter represents adapter filter.
-type Filter struct {
-	P []string
-	G []string
-}
+var (
+	_ persist.ContextFilteredAdapter  = (*Adapter)(nil)
+	_ persist.ContextBatchAdapter     = (*Adapter)(nil)
+	_ persist.ContextUpdatableAdapter = (*Adapter)(nil)
+	_ persist.FilteredAdapter         = (*Adapter)(nil)
+	_ persist.BatchAdapter            = (*Adapter)(nil)
+	_ persist.UpdatableAdapter        = (*Adapter)(nil)
+)
+
+const (
+	defaultSchema     = "casbin"
+	defaultTableName  = "casbin_rules"
+	defaultTableAlias = "cr"
+	defaultBatchSize  = 1000
+	defaultPageSize   = 10000
+
+	defaultColumnCount = 6
+	maxColumnCount     = 10
+)
+
+var (
+	// ErrTooManyFields is returned when a rule or filter has more fields than the configured value columns.
+	ErrTooManyFields = errors.New("rule has more fields than value columns")
+	// ErrRuleNotFound is returned when a rule to update is not stored.
+	ErrRuleNotFound = errors.New("rule not found")
+	// ErrRuleExists is returned when an updated rule equals another stored rule.
+	ErrRuleExists = errors.New("rule already exists")
+	// ErrUnsupportedDialect is returned by NewAdapter for databases other than Postgres and SQLite.
+	ErrUnsupportedDialect = errors.New("unsupported database dialect")
+)
+
+// IDStrategy generates the primary key of a policy rule.
+type IDStrategy func(ptype string, rule []string) string
 
 // Adapter represents the github.com/uptrace/bun adapter for policy storage.
 type Adapter struct {
 	db       *bun.DB
+	tx       bun.IDB
 	filtered bool
+
+	schema       string
+	tableName    string
+	tableAlias   string
+	columnCount  int
+	autoMigrate  bool
+	logger       Logger
+	idStrategy   IDStrategy
+	batchSize    int
+	queryTimeout time.Duration
+	changeLog    bool
+	copyFrom     bool
+	pageSize     int
+	audit        bool
+	opLog        bool
+	opLevel      Level
+	opErrorLevel Level
+	metrics      *metrics
+	tracer       trace.Tracer
 }
 
 // NewAdapter creates new Adapter by using bun's database connection.
-// Expects DB table to be created in database.
-func NewAdapter(db *bun.DB) (*Adapter, error) {
-	return &Adapter{db: db}, nil
+// Expects DB table to be created in database unless WithAutoMigrate is used.
+func NewAdapter(db *bun.DB, opts ...Option) (*Adapter, error) {
+	if db == nil {
+		return nil, errors.New("bun db must not be nil")
+	}
+	if err := checkDialect(db); err != nil {
+		return nil, err
+	}
+
+	a := &Adapter{
+		db:          db,
+		schema:      defaultSchema,
+		tableName:   defaultTableName,
+		tableAlias:  defaultTableAlias,
+		columnCount: defaultColumnCount,
+		logger:      nopLogger{},
+		idStrategy:  HashIDStrategy,
+		batchSize:   defaultBatchSize,
+		pageSize:    defaultPageSize,
+	}
+
+	for _, opt := range opts {
+		if err := opt(a); err != nil {
+			return nil, fmt.Errorf("invalid adapter option: %w", err)
+		}
+	}
+
+	if a.autoMigrate {
+		if err := a.Migrate(context.Background()); err != nil {
+			return nil, fmt.Errorf("failed to migrate adapter db: %w", err)
+		}
+	}
+
+	return a, nil
 }
 
 // LoadPolicy loads policy from the database.
 func (a *Adapter) LoadPolicy(model model.Model) error {
-	var rules []*CasbinRule
+	return a.LoadPolicyCtx(context.Background(), model)
+}
+
+// LoadPolicyCtx loads policy from the database.
+func (a *Adapter) LoadPolicyCtx(ctx context.Context, model model.Model) (err error) {
+	ctx, op := a.startOp(ctx, "LoadPolicy", "")
+	defer a.endOp(op, &err)
+	op.load = true
 
-	if err := a.db.NewSelect().Model(&rules).Scan(context.Background()); err != nil {
-		return fmt.Errorf("failed to load policy from adapter db: %w", err)
+	if op.rules, err = a.loadPolicy(ctx, model); err != nil {
+		return err
 	}
 
-	for _, r := range rules {
-		persist.LoadPolicyLine(r.String(), model)
+	return nil
+}
+
+func (a *Adapter) loadPolicy(ctx context.Context, model model.Model) (int, error) {
+	n, err := a.loadPages(ctx, model, func(query *bun.SelectQuery) (*bun.SelectQuery, error) {
+		return query, nil
+	})
+	if err != nil {
+		return n, fmt.Errorf("failed to load policy from adapter db: %w", err)
 	}
 
 	a.filtered = false
 
-	return nil
+	return n, nil
 }
 
 // SavePolicy saves policy to the database removing any policies already present.
+// Only the difference to the stored policy is written, in one transaction.
 func (a *Adapter) SavePolicy(model model.Model) error {
-	rules := a.extractRules(model)
+	return a.SavePolicyCtx(context.Background(), model)
+}
+
+// SavePolicyCtx saves policy to the database removing any policies already present.
+func (a *Adapter) SavePolicyCtx(ctx context.Context, model model.Model) (err error) {
+	ctx, op := a.startOp(ctx, "SavePolicy", "")
+	defer a.endOp(op, &err)
 
-	if err := a.save(true, rules...); err != nil {
+	rules, err := a.extractRules(model)
+	if err != nil {
+		return fmt.Errorf("failed to save policy to adapter db: %w", err)
+	}
+	op.rules = len(rules)
+
+	if err := a.save(ctx, true, rules...); err != nil {
 		return fmt.Errorf("failed to save policy to adapter db: %w", err)
 	}
 
@@ -58,10 +168,22 @@ func (a *Adapter) SavePolicy(model model.Model) error {
 }
 
 // AddPolicy adds adapter policy rule to the database.
-func (a *Adapter) AddPolicy(_ string, ptype string, rule []string) error {
-	r := newCasbinRule(ptype, rule)
+func (a *Adapter) AddPolicy(sec string, ptype string, rule []string) error {
+	return a.AddPolicyCtx(context.Background(), sec, ptype, rule)
+}
+
+// AddPolicyCtx adds adapter policy rule to the database.
+func (a *Adapter) AddPolicyCtx(ctx context.Context, _ string, ptype string, rule []string) (err error) {
+	ctx, op := a.startOp(ctx, "AddPolicy", ptype)
+	defer a.endOp(op, &err)
 
-	if err := a.save(false, r); err != nil {
+	r, err := a.newCasbinRule(ptype, rule)
+	if err != nil {
+		return fmt.Errorf("failed to add adapter policy rule: %w", err)
+	}
+	op.rules = 1
+
+	if err := a.save(ctx, false, r); err != nil {
 		return fmt.Errorf("failed to add adapter policy rule: %w", err)
 	}
 
@@ -69,13 +191,22 @@ func (a *Adapter) AddPolicy(_ string, ptype string, rule []string) error {
 }
 
 // AddPolicies adds policy rules to the database.
-func (a *Adapter) AddPolicies(_ string, ptype string, rules [][]string) error {
-	casbinRules := make([]*CasbinRule, 0, len(rules))
-	for _, rule := range rules {
-		casbinRules = append(casbinRules, newCasbinRule(ptype, rule))
+func (a *Adapter) AddPolicies(sec string, ptype string, rules [][]string) error {
+	return a.AddPoliciesCtx(context.Background(), sec, ptype, rules)
+}
+
+// AddPoliciesCtx adds policy rules to the database.
+func (a *Adapter) AddPoliciesCtx(ctx context.Context, _ string, ptype string, rules [][]string) (err error) {
+	ctx, op := a.startOp(ctx, "AddPolicies", ptype)
+	defer a.endOp(op, &err)
+
+	casbinRules, err := a.newCasbinRules(ptype, rules)
+	if err != nil {
+		return fmt.Errorf("failed to add policy rules: %w", err)
 	}
+	op.rules = len(casbinRules)
 
-	if err := a.save(false, casbinRules...); err != nil {
+	if err := a.save(ctx, false, casbinRules...); err != nil {
 		return fmt.Errorf("failed to add policy rules: %w", err)
 	}
 
@@ -83,10 +214,22 @@ func (a *Adapter) AddPolicies(_ string, ptype string, rules [][]string) error {
 }
 
 // RemovePolicy removes adapter policy rule from the database.
-func (a *Adapter) RemovePolicy(_ string, ptype string, rule []string) error {
-	r := newCasbinRule(ptype, rule)
+func (a *Adapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	return a.RemovePolicyCtx(context.Background(), sec, ptype, rule)
+}
+
+// RemovePolicyCtx removes adapter policy rule from the database.
+func (a *Adapter) RemovePolicyCtx(ctx context.Context, _ string, ptype string, rule []string) (err error) {
+	ctx, op := a.startOp(ctx, "RemovePolicy", ptype)
+	defer a.endOp(op, &err)
+
+	r, err := a.newCasbinRule(ptype, rule)
+	if err != nil {
+		return fmt.Errorf("failed to remove adapter policy rule: %w", err)
+	}
+	op.rules = 1
 
-	if err := a.delete(r); err != nil {
+	if err := a.delete(ctx, r); err != nil {
 		return fmt.Errorf("failed to remove adapter policy rule: %w", err)
 	}
 
@@ -94,13 +237,22 @@ func (a *Adapter) RemovePolicy(_ string, ptype string, rule []string) error {
 }
 
 // RemovePolicies removes policy rules from the database.
-func (a *Adapter) RemovePolicies(_ string, ptype string, rules [][]string) error {
-	var casbinRules []*CasbinRule
-	for _, rule := range rules {
-		casbinRules = append(casbinRules, newCasbinRule(ptype, rule))
+func (a *Adapter) RemovePolicies(sec string, ptype string, rules [][]string) error {
+	return a.RemovePoliciesCtx(context.Background(), sec, ptype, rules)
+}
+
+// RemovePoliciesCtx removes policy rules from the database.
+func (a *Adapter) RemovePoliciesCtx(ctx context.Context, _ string, ptype string, rules [][]string) (err error) {
+	ctx, op := a.startOp(ctx, "RemovePolicies", ptype)
+	defer a.endOp(op, &err)
+
+	casbinRules, err := a.newCasbinRules(ptype, rules)
+	if err != nil {
+		return fmt.Errorf("failed to remove policy rules: %w", err)
 	}
+	op.rules = len(casbinRules)
 
-	if err := a.delete(casbinRules...); err != nil {
+	if err := a.delete(ctx, casbinRules...); err != nil {
 		return fmt.Errorf("failed to remove policy rules: %w", err)
 	}
 
@@ -108,30 +260,53 @@ func (a *Adapter) RemovePolicies(_ string, ptype string, rules [][]string) error
 }
 
 // RemoveFilteredPolicy removes policy rules that match the filter from the database.
-func (a *Adapter) RemoveFilteredPolicy(_ string, ptype string, fieldIndex int, fieldValues ...string) error {
-	query := a.db.NewDelete().Model((*CasbinRule)(nil)).Where("ptype = ?", ptype)
+func (a *Adapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	return a.RemoveFilteredPolicyCtx(context.Background(), sec, ptype, fieldIndex, fieldValues...)
+}
 
-	idx := fieldIndex + len(fieldValues)
-	if fieldIndex <= 0 && idx > 0 && fieldValues[0-fieldIndex] != "" {
-		query = query.Where("v0 = ?", fieldValues[0-fieldIndex])
-	}
-	if fieldIndex <= 1 && idx > 1 && fieldValues[1-fieldIndex] != "" {
-		query = query.Where("v1 = ?", fieldValues[1-fieldIndex])
-	}
-	if fieldIndex <= 2 && idx > 2 && fieldValues[2-fieldIndex] != "" {
-		query = query.Where("v2 = ?", fieldValues[2-fieldIndex])
-	}
-	if fieldIndex <= 3 && idx > 3 && fieldValues[3-fieldIndex] != "" {
-		query = query.Where("v3 = ?", fieldValues[3-fieldIndex])
-	}
-	if fieldIndex <= 4 && idx > 4 && fieldValues[4-fieldIndex] != "" {
-		query = query.Where("v4 = ?", fieldValues[4-fieldIndex])
-	}
-	if fieldIndex <= 5 && idx > 5 && fieldValues[5-fieldIndex] != "" {
-		query = query.Where("v5 = ?", fieldValues[5-fieldIndex])
+// RemoveFilteredPolicyCtx removes policy rules that match the filter from the database.
+func (a *Adapter) RemoveFilteredPolicyCtx(ctx context.Context, _ string, ptype string, fieldIndex int, fieldValues ...string) (err error) {
+	ctx, op := a.startOp(ctx, "RemoveFilteredPolicy", ptype)
+	defer a.endOp(op, &err)
+
+	var fields []Matcher
+	for i, v := range fieldValues {
+		idx := fieldIndex + i
+		if v == "" || idx < 0 {
+			continue
+		}
+		if idx >= a.columnCount {
+			return fmt.Errorf("failed to remove filtered policy: %w: field index %d", ErrTooManyFields, idx)
+		}
+		for len(fields) <= idx {
+			fields = append(fields, Any())
+		}
+		fields[idx] = Eq(v)
 	}
 
-	_, err := query.Exec(context.Background())
+	err = a.runInTx(ctx, func(ctx context.Context, tx bun.IDB) error {
+		var lines []*CasbinRule
+
+		query, err := a.filterQuery(a.newSelect(tx, &lines), map[string][]Matcher{ptype: fields})
+		if err != nil {
+			return err
+		}
+		if err := query.Scan(ctx); err != nil {
+			return err
+		}
+		op.rules = len(lines)
+
+		deleted, err := a.deleteRules(ctx, tx, lines...)
+		if err != nil {
+			return err
+		}
+
+		if err := a.auditRules(ctx, tx, AuditRemoveFiltered, deleted, nil); err != nil {
+			return err
+		}
+
+		return a.logChanges(ctx, tx, deleted, nil)
+	})
 	if err != nil {
 		return fmt.Errorf("failed to remove filtered policy: %w", err)
 	}
@@ -141,59 +316,131 @@ func (a *Adapter) RemoveFilteredPolicy(_ string, ptype string, fieldIndex int, f
 
 // LoadFilteredPolicy loads adapter policy from the database that matches the filter.
 func (a *Adapter) LoadFilteredPolicy(model model.Model, filter interface{}) error {
+	return a.LoadFilteredPolicyCtx(context.Background(), model, filter)
+}
+
+// LoadFilteredPolicyCtx loads adapter policy from the database that matches the filter.
+func (a *Adapter) LoadFilteredPolicyCtx(ctx context.Context, model model.Model, filter interface{}) (err error) {
+	ctx, op := a.startOp(ctx, "LoadFilteredPolicy", "")
+	defer a.endOp(op, &err)
+	op.load = true
+
 	if filter == nil {
-		return a.LoadPolicy(model)
-	}
+		op.rules, err = a.loadPolicy(ctx, model)
 
-	filterValue, ok := filter.(*Filter)
-	if !ok {
+		return err
+	}
+	op.filtered = true
+
+	var matchers map[string][]Matcher
+	switch f := filter.(type) {
+	case *Filter:
+		matchers = f.matchers()
+	case *QueryFilter:
+		matchers = f.matchers()
+	default:
 		return fmt.Errorf("invalid filter type")
 	}
+	op.filter = filterShape(matchers)
 
-	err := a.loadFilteredPolicy(model, filterValue)
-	if err != nil {
+	if op.rules, err = a.loadFilteredPolicy(ctx, model, matchers); err != nil {
 		return err
 	}
 	a.filtered = true
 	return nil
 }
 
-func (a *Adapter) loadFilteredPolicy(model model.Model, filter *Filter) error {
-	if filter.P != nil {
-		var lines []*CasbinRule
+// LoadFilteredPolicies loads adapter policy from the database that matches any of the filters.
+// The filters are combined into a single query, so rules matched by several filters are loaded once.
+func (a *Adapter) LoadFilteredPolicies(model model.Model, filters []*Filter) error {
+	return a.LoadFilteredPoliciesCtx(context.Background(), model, filters)
+}
 
-		query := a.db.NewSelect().Model(&lines).Where("ptype = 'p'")
-		query, err := a.buildQuery(query, filter.P)
-		if err != nil {
-			return err
-		}
-		err = query.Scan(context.Background())
-		if err != nil {
-			return err
+// LoadFilteredPoliciesCtx loads adapter policy from the database that matches any of the filters.
+// The filters are combined into a single query, so rules matched by several filters are loaded once.
+func (a *Adapter) LoadFilteredPoliciesCtx(ctx context.Context, model model.Model, filters []*Filter) (err error) {
+	ctx, op := a.startOp(ctx, "LoadFilteredPolicies", "")
+	defer a.endOp(op, &err)
+	op.load, op.filtered = true, true
+
+	matchers := make([]map[string][]Matcher, 0, len(filters))
+	for _, filter := range filters {
+		if filter == nil {
+			return errors.New("invalid filter: nil")
 		}
+		matchers = append(matchers, filter.matchers())
+	}
+	op.filter = filterShape(matchers...)
 
-		for _, line := range lines {
-			persist.LoadPolicyLine(line.String(), model)
-		}
+	if op.rules, err = a.loadFilteredPolicy(ctx, model, matchers...); err != nil {
+		return err
 	}
-	if filter.G != nil {
-		var lines []*CasbinRule
+	a.filtered = true
+	return nil
+}
+
+func (a *Adapter) loadFilteredPolicy(ctx context.Context, model model.Model, filters ...map[string][]Matcher) (int, error) {
+	return a.loadPages(ctx, model, func(query *bun.SelectQuery) (*bun.SelectQuery, error) {
+		return a.filterQuery(query, filters...)
+	})
+}
+
+// loadPages loads the rules selected by filter into the model page by page, ordered by ID,
+// so only a single page of rules is held in memory. It returns the number of loaded rules.
+// The pages are read in one snapshot transaction, so concurrent changes cannot tear the load.
+func (a *Adapter) loadPages(
+	ctx context.Context, model model.Model, filter func(query *bun.SelectQuery) (*bun.SelectQuery, error),
+) (int, error) {
+	if a.tx != nil || a.pageSize <= 0 {
+		return a.scanPages(ctx, a.idb(), model, filter)
+	}
+
+	var n int
+
+	err := runInSnapshot(ctx, a.db, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		n, err = a.scanPages(ctx, tx, model, filter)
 
-		query := a.db.NewSelect().Model(&lines).Where("ptype = 'g'")
-		query, err := a.buildQuery(query, filter.G)
+		return err
+	})
+
+	return n, err
+}
+
+func (a *Adapter) scanPages(
+	ctx context.Context, db bun.IDB, model model.Model, filter func(query *bun.SelectQuery) (*bun.SelectQuery, error),
+) (int, error) {
+	var (
+		lastID *string
+		n      int
+	)
+
+	for {
+		var page []*CasbinRule
+
+		query, err := filter(a.newSelect(db, &page))
 		if err != nil {
-			return err
+			return n, err
 		}
-		err = query.Scan(context.Background())
-		if err != nil {
-			return err
+		if a.pageSize > 0 {
+			query = query.OrderExpr("?.id", bun.Ident(a.tableAlias)).Limit(a.pageSize)
+		}
+		if lastID != nil {
+			query = query.Where("?.id > ?", bun.Ident(a.tableAlias), *lastID)
 		}
 
-		for _, line := range lines {
-			persist.LoadPolicyLine(line.String(), model)
+		if err := query.Scan(ctx); err != nil {
+			return n, err
 		}
+
+		a.loadRules(model, page)
+		n += len(page)
+
+		if a.pageSize <= 0 || len(page) < a.pageSize {
+			return n, nil
+		}
+		lastID = &page[len(page)-1].ID
 	}
-	return nil
 }
 
 // IsFiltered returns true if the loaded policy has been filtered.
@@ -201,180 +448,526 @@ func (a *Adapter) IsFiltered() bool {
 	return a.filtered
 }
 
+// IsFilteredCtx returns true if the loaded policy has been filtered.
+func (a *Adapter) IsFilteredCtx(_ context.Context) bool {
+	return a.IsFiltered()
+}
+
 // UpdatePolicy updates adapter policy rule from the database.
 // This is part of the Auto-Save feature.
 func (a *Adapter) UpdatePolicy(sec string, ptype string, oldRule, newPolicy []string) error {
-	return a.UpdatePolicies(sec, ptype, [][]string{oldRule}, [][]string{newPolicy})
+	return a.UpdatePolicyCtx(context.Background(), sec, ptype, oldRule, newPolicy)
+}
+
+// UpdatePolicyCtx updates adapter policy rule from the database.
+// This is part of the Auto-Save feature.
+func (a *Adapter) UpdatePolicyCtx(ctx context.Context, _ string, ptype string, oldRule, newPolicy []string) (err error) {
+	ctx, op := a.startOp(ctx, "UpdatePolicy", ptype)
+	defer a.endOp(op, &err)
+
+	return a.updatePolicies(ctx, op, ptype, [][]string{oldRule}, [][]string{newPolicy})
 }
 
 // UpdatePolicies updates some policy rules to the database.
-func (a *Adapter) UpdatePolicies(_ string, ptype string, oldRules, newRules [][]string) error {
-	oldLines := make([]*CasbinRule, 0, len(oldRules))
-	newLines := make([]*CasbinRule, 0, len(newRules))
+func (a *Adapter) UpdatePolicies(sec string, ptype string, oldRules, newRules [][]string) error {
+	return a.UpdatePoliciesCtx(context.Background(), sec, ptype, oldRules, newRules)
+}
 
-	for _, rule := range oldRules {
-		oldLines = append(oldLines, newCasbinRule(ptype, rule))
+// UpdatePoliciesCtx updates some policy rules to the database.
+// It fails with ErrRuleNotFound when an old rule is not stored and with ErrRuleExists
+// when a new rule equals another stored rule. The rows matched by each old rule are reported
+// in the operation log and span, see WithOperationLog and WithTracing.
+func (a *Adapter) UpdatePoliciesCtx(ctx context.Context, _ string, ptype string, oldRules, newRules [][]string) (err error) {
+	ctx, op := a.startOp(ctx, "UpdatePolicies", ptype)
+	defer a.endOp(op, &err)
+
+	return a.updatePolicies(ctx, op, ptype, oldRules, newRules)
+}
+
+func (a *Adapter) updatePolicies(ctx context.Context, op *operation, ptype string, oldRules, newRules [][]string) error {
+	if len(oldRules) != len(newRules) {
+		return fmt.Errorf("failed to update policies: %d old rules for %d new rules", len(oldRules), len(newRules))
 	}
 
-	for _, rule := range newRules {
-		newLines = append(newLines, newCasbinRule(ptype, rule))
+	oldLines, err := a.newCasbinRules(ptype, oldRules)
+	if err != nil {
+		return fmt.Errorf("failed to update policies: %w", err)
 	}
 
-	tx, err := a.db.Begin()
+	newLines, err := a.newCasbinRules(ptype, newRules)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to update policies: %w", err)
 	}
+	op.rules = len(newLines)
 
-	for i, line := range oldLines {
-		str, args := line.queryString()
-		_, err = tx.NewUpdate().Model(newLines[i]).Where(str, args...).Exec(context.Background())
-		if err != nil {
-			tx.Rollback()
+	err = a.runInTx(ctx, func(ctx context.Context, tx bun.IDB) error {
+		removed := make([]*CasbinRule, 0, len(oldLines))
+		for i, line := range oldLines {
+			matched, err := a.updateRule(ctx, tx, line, newLines[i])
+			if err != nil {
+				return err
+			}
+			removed = append(removed, matched...)
+		}
 
+		if err := a.auditUpdates(ctx, tx, oldLines, newLines); err != nil {
 			return err
 		}
+
+		return a.logChanges(ctx, tx, removed, newLines)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update policies: %w", err)
 	}
 
-	return tx.Commit()
+	return nil
 }
 
-// UpdateFilteredPolicies updates some policy rules in the database.
-func (a *Adapter) UpdateFilteredPolicies(_ string, ptype string, newRules [][]string, fieldIndex int, fieldValues ...string) ([][]string, error) {
-	line := &CasbinRule{}
+// updateRule replaces the stored rules equal to oldLine with newLine and returns the replaced rules.
+// The rules are deleted and inserted rather than updated in place, so the ID always matches the stored values.
+func (a *Adapter) updateRule(ctx context.Context, db bun.IDB, oldLine, newLine *CasbinRule) ([]*CasbinRule, error) {
+	matchers := make([]Matcher, 0, a.columnCount)
+	fields := oldLine.fields()
+	for _, v := range fields[:a.columnCount] {
+		if *v == "" {
+			matchers = append(matchers, Empty())
+		} else {
+			matchers = append(matchers, Eq(*v))
+		}
+	}
+
+	var matched []*CasbinRule
 
-	line.Ptype = ptype
-	if fieldIndex <= 0 && 0 < fieldIndex+len(fieldValues) {
-		line.V0 = fieldValues[0-fieldIndex]
+	query, err := a.filterQuery(a.newSelect(db, &matched), map[string][]Matcher{oldLine.Ptype: matchers})
+	if err != nil {
+		return nil, err
 	}
-	if fieldIndex <= 1 && 1 < fieldIndex+len(fieldValues) {
-		line.V1 = fieldValues[1-fieldIndex]
+	if err := query.Scan(ctx); err != nil {
+		return nil, err
+	}
+
+	addMatched(ctx, len(matched))
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrRuleNotFound, oldLine)
 	}
-	if fieldIndex <= 2 && 2 < fieldIndex+len(fieldValues) {
-		line.V2 = fieldValues[2-fieldIndex]
+
+	ids := make([]string, 0, len(matched))
+	for _, line := range matched {
+		ids = append(ids, line.ID)
 	}
-	if fieldIndex <= 3 && 3 < fieldIndex+len(fieldValues) {
-		line.V3 = fieldValues[3-fieldIndex]
+
+	exists, err := db.NewSelect().
+		ModelTableExpr("?", a.table()).
+		Where("id = ?", newLine.ID).
+		Where("id NOT IN (?)", bun.In(ids)).
+		Exists(ctx)
+	if err != nil {
+		return nil, err
 	}
-	if fieldIndex <= 4 && 4 < fieldIndex+len(fieldValues) {
-		line.V4 = fieldValues[4-fieldIndex]
+	if exists {
+		return nil, fmt.Errorf("%w: %s", ErrRuleExists, newLine)
 	}
-	if fieldIndex <= 5 && 5 < fieldIndex+len(fieldValues) {
-		line.V5 = fieldValues[5-fieldIndex]
+
+	res, err := a.newDelete(db, (*CasbinRule)(nil)).Where("id IN (?)", bun.In(ids)).Exec(ctx)
+	if err != nil {
+		return nil, err
 	}
+	addAffected(ctx, res)
 
-	newP := make([]CasbinRule, 0, len(newRules))
-	for _, nr := range newRules {
-		newP = append(newP, *(newCasbinRule(ptype, nr)))
+	res, err = a.newInsert(db, newLine).Exec(ctx)
+	if err != nil {
+		return nil, err
 	}
+	addAffected(ctx, res)
 
-	oldP := make([]CasbinRule, 0)
-	oldP = append(oldP, *line)
+	return matched, nil
+}
 
-	err := a.db.RunInTx(context.Background(), nil, func(ctx context.Context, tx bun.Tx) error {
-		for i := range newP {
-			str, args := line.queryString()
-			result, err := tx.NewDelete().Model(&oldP).Where(str, args...).Returning("*").Exec(ctx)
-			fmt.Println(result)
-			if err != nil {
-				return err
-			}
+// UpdateFilteredPolicies updates some policy rules in the database.
+func (a *Adapter) UpdateFilteredPolicies(sec string, ptype string, newRules [][]string, fieldIndex int, fieldValues ...string) ([][]string, error) {
+	return a.UpdateFilteredPoliciesCtx(context.Background(), sec, ptype, newRules, fieldIndex, fieldValues...)
+}
 
-			_, err = tx.NewInsert().Model(&newP[i]).On("CONFLICT DO NOTHING").Exec(ctx)
-			if err != nil {
-				return err
-			}
+// UpdateFilteredPoliciesCtx replaces the policy rules matching the filter with newRules
+// and returns the replaced rules.
+func (a *Adapter) UpdateFilteredPoliciesCtx(ctx context.Context, _ string, ptype string, newRules [][]string, fieldIndex int, fieldValues ...string) (_ [][]string, err error) {
+	ctx, op := a.startOp(ctx, "UpdateFilteredPolicies", ptype)
+	defer a.endOp(op, &err)
+
+	filter := &CasbinRule{Ptype: ptype}
+
+	fields := filter.fields()
+	for i, v := range fieldValues {
+		idx := fieldIndex + i
+		if idx < 0 {
+			continue
 		}
+		if idx >= a.columnCount {
+			return nil, fmt.Errorf("failed to update filtered policies: %w: field index %d", ErrTooManyFields, idx)
+		}
+		*fields[idx] = v
+	}
 
-		return nil
+	newLines, err := a.newCasbinRules(ptype, newRules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update filtered policies: %w", err)
+	}
+	op.rules = len(newLines)
+
+	var oldLines []*CasbinRule
+
+	err = a.runInTx(ctx, func(ctx context.Context, tx bun.IDB) error {
+		str, args := filter.queryString()
+		res, err := a.deleteReturning(ctx, tx, &oldLines, str, args...)
+		if err != nil {
+			return err
+		}
+		addAffected(ctx, res)
+
+		inserted, err := a.insertRules(ctx, tx, newLines...)
+		if err != nil {
+			return err
+		}
+
+		if err := a.auditRules(ctx, tx, AuditUpdateFiltered, oldLines, inserted); err != nil {
+			return err
+		}
+
+		return a.logChanges(ctx, tx, oldLines, inserted)
 	})
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to update filtered policies: %w", err)
 	}
 
-	// return deleted rules
-	oldPolicies := make([][]string, 0)
-	for _, v := range oldP {
-		oldPolicy := v.toStringPolicy()
-		oldPolicies = append(oldPolicies, oldPolicy)
+	// Casbin removes the returned rules from the model, they have no ptype.
+	oldRules := make([][]string, 0, len(oldLines))
+	for _, line := range oldLines {
+		oldRules = append(oldRules, line.values())
 	}
-	return oldPolicies, nil
+
+	return oldRules, nil
 }
 
-// Close closes adapter database connection.
+// WithTx returns a view of the adapter running its queries in the caller's transaction tx,
+// so policy changes commit or roll back together with application data.
+// Roll back tx when a policy change fails, the view does not undo partial writes itself.
+// With WithChangeLog the first policy change locks the change log until tx ends, blocking the policy writes
+// of every other adapter on the table meanwhile, so keep tx short after changing policies.
+func (a *Adapter) WithTx(tx bun.Tx) *Adapter {
+	view := *a
+	view.tx = tx
+
+	return &view
+}
+
+// Close closes adapter database connection. Closing a WithTx view leaves the database open.
 func (a *Adapter) Close() error {
+	if a.tx != nil {
+		return nil
+	}
+
 	return a.db.Close()
 }
 
-func (a *Adapter) extractRules(model model.Model) []*CasbinRule {
+func (a *Adapter) extractRules(model model.Model) ([]*CasbinRule, error) {
 	var casbinRules []*CasbinRule
 
 	for ptype, assertion := range model["p"] {
-		for _, rule := range assertion.Policy {
-			casbinRules = append(casbinRules, newCasbinRule(ptype, rule))
+		rules, err := a.newCasbinRules(ptype, assertion.Policy)
+		if err != nil {
+			return nil, err
 		}
+		casbinRules = append(casbinRules, rules...)
 	}
 
 	for ptype, assertion := range model["g"] {
-		for _, rule := range assertion.Policy {
-			casbinRules = append(casbinRules, newCasbinRule(ptype, rule))
+		rules, err := a.newCasbinRules(ptype, assertion.Policy)
+		if err != nil {
+			return nil, err
 		}
+		casbinRules = append(casbinRules, rules...)
 	}
 
-	return casbinRules
+	return casbinRules, nil
 }
 
-func (a *Adapter) save(truncate bool, lines ...*CasbinRule) error {
-	return a.db.RunInTx(context.Background(), nil, func(ctx context.Context, tx bun.Tx) error {
-		if truncate {
-			_, err := tx.NewTruncateTable().Model((*CasbinRule)(nil)).Exec(context.Background())
-			if err != nil {
-				return err
-			}
+func (a *Adapter) save(ctx context.Context, replace bool, lines ...*CasbinRule) error {
+	if a.copyFrom && a.tx == nil {
+		return a.runInConnTx(ctx, func(ctx context.Context, conn bun.Conn) error {
+			return a.saveRules(ctx, conn, replace, lines...)
+		})
+	}
+
+	return a.runInTx(ctx, func(ctx context.Context, tx bun.IDB) error {
+		return a.saveRules(ctx, tx, replace, lines...)
+	})
+}
+
+// idb returns the database queries run on, the bound transaction of a WithTx view.
+func (a *Adapter) idb() bun.IDB {
+	if a.tx != nil {
+		return a.tx
+	}
+
+	return a.db
+}
+
+// runInTx runs fn in a new transaction, or in the bound transaction of a WithTx view.
+func (a *Adapter) runInTx(ctx context.Context, fn func(ctx context.Context, tx bun.IDB) error) error {
+	if a.tx != nil {
+		return fn(ctx, a.tx)
+	}
+
+	return a.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		return fn(ctx, tx)
+	})
+}
+
+// saveRules inserts the rules, with replace it deletes the stored rules missing in lines
+// and inserts only the new ones instead of rewriting the table.
+func (a *Adapter) saveRules(ctx context.Context, db bun.IDB, replace bool, lines ...*CasbinRule) error {
+	var deleted []*CasbinRule
+
+	added, op := lines, AuditAdd
+
+	if replace {
+		var stored, removed []*CasbinRule
+
+		if err := a.newSelect(db, &stored).Scan(ctx); err != nil {
+			return err
 		}
 
-		for _, line := range lines {
-			_, err := tx.NewInsert().Model(line).On("CONFLICT DO NOTHING").Exec(context.Background())
-			if err != nil {
-				return err
-			}
+		removed, added = diffRules(stored, lines)
+		op = AuditSave
+
+		var err error
+		if deleted, err = a.deleteRules(ctx, db, removed...); err != nil {
+			return err
 		}
+	}
 
-		return nil
+	inserted, err := a.insertRules(ctx, db, added...)
+	if err != nil {
+		return err
+	}
+
+	if err := a.auditRules(ctx, db, op, deleted, inserted); err != nil {
+		return err
+	}
+
+	return a.logChanges(ctx, db, deleted, inserted)
+}
+
+// diffRules returns the rules of before missing in after and the rules of after missing in before.
+// Rules are compared by ID and values, so a stored rule whose ID does not match its values is rewritten.
+func diffRules(before, after []*CasbinRule) (removed, added []*CasbinRule) {
+	type ruleKey struct{ id, rule string }
+
+	beforeKeys := make(map[ruleKey]struct{}, len(before))
+	for _, line := range before {
+		beforeKeys[ruleKey{line.ID, line.String()}] = struct{}{}
+	}
+	afterKeys := make(map[ruleKey]struct{}, len(after))
+	for _, line := range after {
+		key := ruleKey{line.ID, line.String()}
+		afterKeys[key] = struct{}{}
+		if _, ok := beforeKeys[key]; !ok {
+			added = append(added, line)
+		}
+	}
+	for _, line := range before {
+		if _, ok := afterKeys[ruleKey{line.ID, line.String()}]; !ok {
+			removed = append(removed, line)
+		}
+	}
+
+	return removed, added
+}
+
+// insertRules inserts the rules skipping existing ones, with multi-row inserts of up to batchSize rules
+// or with COPY when enabled and db is a connection. It returns the inserted rules.
+func (a *Adapter) insertRules(ctx context.Context, db bun.IDB, lines ...*CasbinRule) ([]*CasbinRule, error) {
+	if conn, ok := db.(bun.Conn); ok && a.copyFrom {
+		return a.copyRules(ctx, conn, lines...)
+	}
+
+	var inserted []*CasbinRule
+
+	for start := 0; start < len(lines); start += a.batchSize {
+		end := start + a.batchSize
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		batch, err := a.insertReturning(ctx, db, lines[start:end])
+		if err != nil {
+			return nil, err
+		}
+		inserted = append(inserted, batch...)
+	}
+
+	return inserted, nil
+}
+
+func (a *Adapter) delete(ctx context.Context, lines ...*CasbinRule) error {
+	return a.runInTx(ctx, func(ctx context.Context, tx bun.IDB) error {
+		deleted, err := a.deleteRules(ctx, tx, lines...)
+		if err != nil {
+			return err
+		}
+
+		if err := a.auditRules(ctx, tx, AuditRemove, deleted, nil); err != nil {
+			return err
+		}
+
+		return a.logChanges(ctx, tx, deleted, nil)
 	})
 }
 
-func (a *Adapter) delete(lines ...*CasbinRule) error {
-	_, err := a.db.NewDelete().Model(&lines).WherePK().Exec(context.Background())
+// deleteRules deletes the rules by ID and returns the deleted ones.
+func (a *Adapter) deleteRules(ctx context.Context, db bun.IDB, lines ...*CasbinRule) ([]*CasbinRule, error) {
+	ids := make([]string, 0, len(lines))
+	for _, line := range lines {
+		ids = append(ids, line.ID)
+	}
 
-	return err
+	var deleted []*CasbinRule
+
+	for start := 0; start < len(ids); start += a.batchSize {
+		end := start + a.batchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		var batch []*CasbinRule
+
+		res, err := a.deleteReturning(ctx, db, &batch, "id IN (?)", bun.In(ids[start:end]))
+		if err != nil {
+			return nil, err
+		}
+		addAffected(ctx, res)
+		deleted = append(deleted, batch...)
+	}
+
+	return deleted, nil
 }
 
-func (a *Adapter) buildQuery(query *bun.SelectQuery, values []string) (*bun.SelectQuery, error) {
-	for ind, v := range values {
-		if v == "" {
+// loadRules adds the rules to the model as they are stored, values are not re-parsed
+// so commas and quotes inside them are preserved.
+func (a *Adapter) loadRules(model model.Model, rules []*CasbinRule) {
+	for _, r := range rules {
+		if r.Ptype == "" {
+			a.logger.Warn("skipped policy rule without ptype", "id", r.ID)
 			continue
 		}
-		switch ind {
-		case 0:
-			query = query.Where("v0 = ?", v)
-		case 1:
-			query = query.Where("v1 = ?", v)
-		case 2:
-			query = query.Where("v2 = ?", v)
-		case 3:
-			query = query.Where("v3 = ?", v)
-		case 4:
-			query = query.Where("v4 = ?", v)
-		case 5:
-			query = query.Where("v5 = ?", v)
-		default:
-			return nil, fmt.Errorf("filter has more values than expected, should not exceed 6 values")
+		if err := persist.LoadPolicyArray(r.toStringPolicy(), model); err != nil {
+			a.logger.Warn("failed to load policy rule", "rule", r.String(), "error", err)
 		}
 	}
-	return query, nil
+}
+
+func (a *Adapter) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if a.queryTimeout <= 0 {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, a.queryTimeout)
+}
+
+func (a *Adapter) newCasbinRule(ptype string, rule []string) (*CasbinRule, error) {
+	if len(rule) > a.columnCount {
+		return nil, fmt.Errorf("%w: %d fields, %d columns", ErrTooManyFields, len(rule), a.columnCount)
+	}
+
+	line := newCasbinRule(ptype, rule)
+	line.ID = a.idStrategy(ptype, rule)
+
+	return line, nil
+}
+
+func (a *Adapter) newCasbinRules(ptype string, rules [][]string) ([]*CasbinRule, error) {
+	lines := make([]*CasbinRule, 0, len(rules))
+	for _, rule := range rules {
+		line, err := a.newCasbinRule(ptype, rule)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, nil
+}
+
+// columns returns the names of the table columns the adapter reads and writes.
+func (a *Adapter) columns() []string {
+	columns := make([]string, 0, a.columnCount+3)
+	columns = append(columns, "id", "ptype")
+	for i := 0; i < a.columnCount; i++ {
+		columns = append(columns, valueColumn(i))
+	}
+	columns = append(columns, "field_count")
+
+	return columns
+}
+
+// columnIdents returns the quoted column names of columns.
+func (a *Adapter) columnIdents() []bun.Ident {
+	columns := a.columns()
+	idents := make([]bun.Ident, 0, len(columns))
+	for _, column := range columns {
+		idents = append(idents, bun.Ident(column))
+	}
+
+	return idents
+}
+
+// table returns the schema-qualified name of the policy table.
+func (a *Adapter) table() bun.Ident {
+	return a.qualify(a.tableName)
+}
+
+func (a *Adapter) newSelect(db bun.IDB, model interface{}) *bun.SelectQuery {
+	return a.newSelectFrom(db, model, a.table())
+}
+
+// newSelectFrom selects rules from table, which has the columns of the policy table.
+func (a *Adapter) newSelectFrom(db bun.IDB, model interface{}, table bun.Ident) *bun.SelectQuery {
+	query := db.NewSelect().Model(model).ModelTableExpr("? AS ?", table, bun.Ident(a.tableAlias))
+	for _, column := range a.columns() {
+		query = query.ColumnExpr("?.?", bun.Ident(a.tableAlias), bun.Ident(column))
+	}
+
+	return query
+}
+
+func (a *Adapter) newInsert(db bun.IDB, model interface{}) *bun.InsertQuery {
+	return db.NewInsert().Model(model).ModelTableExpr("?", a.table()).Column(a.columns()...)
+}
+
+func (a *Adapter) newDelete(db bun.IDB, model interface{}) *bun.DeleteQuery {
+	return db.NewDelete().Model(model).ModelTableExpr("?", a.table())
+}
+
+// HashIDStrategy is the default IDStrategy, it hashes ptype and rule values.
+// Every value is prefixed with its length, so rules differing only in where a comma sits get different IDs.
+func HashIDStrategy(ptype string, rule []string) string {
+	var data []byte
+	for _, v := range append([]string{ptype}, rule...) {
+		data = strconv.AppendInt(data, int64(len(v)), 10)
+		data = append(data, ':')
+		data = append(data, v...)
+	}
+	sum := meow.Checksum(0, data)
+
+	return fmt.Sprintf("%x", sum)
+}
+
+func valueColumn(i int) string {
+	return fmt.Sprintf("v%d", i)
 }
 
 // CasbinRule represents adapter rule in Casbin.
+// The table name in the model tag is the default one, see WithSchema and WithTableName.
 type CasbinRule struct {
 	bun.BaseModel `bun:"table:casbin.casbin_rules,alias:cr"`
 
@@ -386,138 +979,86 @@ type CasbinRule struct {
 	V3    string
 	V4    string
 	V5    string
+	V6    string
+	V7    string
+	V8    string
+	V9    string
+
+	// FieldCount is the number of rule values, including empty ones.
+	// Zero for rules stored before it was tracked.
+	FieldCount int `bun:",notnull"`
 }
 
 func newCasbinRule(ptype string, rule []string) *CasbinRule {
-	line := &CasbinRule{Ptype: ptype}
+	line := &CasbinRule{Ptype: ptype, FieldCount: len(rule)}
 
-	l := len(rule)
-	if l > 0 {
-		line.V0 = rule[0]
-	}
-	if l > 1 {
-		line.V1 = rule[1]
-	}
-	if l > 2 {
-		line.V2 = rule[2]
+	fields := line.fields()
+	for i, v := range rule {
+		*fields[i] = v
 	}
-	if l > 3 {
-		line.V3 = rule[3]
-	}
-	if l > 4 {
-		line.V4 = rule[4]
-	}
-	if l > 5 {
-		line.V5 = rule[5]
+
+	return line
+}
+
+// fields returns pointers to the value fields of the rule in column order.
+func (r *CasbinRule) fields() [maxColumnCount]*string {
+	return [maxColumnCount]*string{&r.V0, &r.V1, &r.V2, &r.V3, &r.V4, &r.V5, &r.V6, &r.V7, &r.V8, &r.V9}
+}
+
+// values returns the rule values. Rules without a field count are trimmed of trailing empty values.
+func (r *CasbinRule) values() []string {
+	fields := r.fields()
+
+	n := r.FieldCount
+	if n <= 0 || n > len(fields) {
+		n = len(fields)
+		for n > 0 && *fields[n-1] == "" {
+			n--
+		}
 	}
 
-	line.ID = line.policyID(ptype, rule)
+	values := make([]string, 0, n)
+	for _, v := range fields[:n] {
+		values = append(values, *v)
+	}
 
-	return line
+	return values
 }
 
 func (r *CasbinRule) String() string {
 	const prefixLine = ", "
 	var sb strings.Builder
 
-	sb.Grow(
-		len(r.Ptype) +
-			len(r.V0) + len(r.V1) + len(r.V2) +
-			len(r.V3) + len(r.V4) + len(r.V5),
-	)
-
 	sb.WriteString(r.Ptype)
-	if len(r.V0) > 0 {
-		sb.WriteString(prefixLine)
-		sb.WriteString(r.V0)
-	}
-	if len(r.V1) > 0 {
-		sb.WriteString(prefixLine)
-		sb.WriteString(r.V1)
-	}
-	if len(r.V2) > 0 {
-		sb.WriteString(prefixLine)
-		sb.WriteString(r.V2)
-	}
-	if len(r.V3) > 0 {
-		sb.WriteString(prefixLine)
-		sb.WriteString(r.V3)
-	}
-	if len(r.V4) > 0 {
-		sb.WriteString(prefixLine)
-		sb.WriteString(r.V4)
-	}
-	if len(r.V5) > 0 {
+	for _, v := range r.values() {
 		sb.WriteString(prefixLine)
-		sb.WriteString(r.V5)
+		sb.WriteString(v)
 	}
 
 	return sb.String()
 }
 
-func (r *CasbinRule) policyID(ptype string, rule []string) string {
-	data := strings.Join(append([]string{ptype}, rule...), ",")
-	sum := meow.Checksum(0, []byte(data))
-
-	return fmt.Sprintf("%x", sum)
-}
-
 func (r *CasbinRule) queryString() (string, []interface{}) {
 	queryArgs := []interface{}{r.Ptype}
 
 	queryStr := "ptype = ?"
-	if r.V0 != "" {
-		queryStr += " and v0 = ?"
-		queryArgs = append(queryArgs, r.V0)
-	}
-	if r.V1 != "" {
-		queryStr += " and v1 = ?"
-		queryArgs = append(queryArgs, r.V1)
-	}
-	if r.V2 != "" {
-		queryStr += " and v2 = ?"
-		queryArgs = append(queryArgs, r.V2)
-	}
-	if r.V3 != "" {
-		queryStr += " and v3 = ?"
-		queryArgs = append(queryArgs, r.V3)
-	}
-	if r.V4 != "" {
-		queryStr += " and v4 = ?"
-		queryArgs = append(queryArgs, r.V4)
-	}
-	if r.V5 != "" {
-		queryStr += " and v5 = ?"
-		queryArgs = append(queryArgs, r.V5)
+	for i, v := range r.fields() {
+		if *v != "" {
+			queryStr += " and " + valueColumn(i) + " = ?"
+			queryArgs = append(queryArgs, *v)
+		}
 	}
 
 	return queryStr, queryArgs
 }
 
 func (r *CasbinRule) toStringPolicy() []string {
-	policy := make([]string, 0, 7)
+	policy := make([]string, 0, maxColumnCount+1)
 
 	if r.Ptype != "" {
 		policy = append(policy, r.Ptype)
 	}
-	if r.V0 != "" {
-		policy = append(policy, r.V0)
-	}
-	if r.V1 != "" {
-		policy = append(policy, r.V1)
-	}
-	if r.V2 != "" {
-		policy = append(policy, r.V2)
-	}
-	if r.V3 != "" {
-		policy = append(policy, r.V3)
-	}
-	if r.V4 != "" {
-		policy = append(policy, r.V4)
-	}
-	if r.V5 != "" {
-		policy = append(policy, r.V5)
-	}
+	policy = append(policy, r.values()...)
 
 	return policy
 }
@@ -0,0 +1,131 @@
+package bunadapter_test
+
+import (
+	"context"
+
+	"github.com/casbin/casbin/v2"
+
+	bunadapter "github.com/msales/casbin-bun-adapter"
+)
+
+// auditHistory returns the audit entries matching q, skipping the entries of previous tests.
+func (suite *AdapterTestSuite) auditHistory(adapter *bunadapter.Adapter, q bunadapter.AuditQuery, after int64) []*bunadapter.AuditEntry {
+	suite.T().Helper()
+
+	entries, err := adapter.AuditHistory(context.Background(), q)
+	suite.Require().NoError(err)
+
+	var res []*bunadapter.AuditEntry
+	for _, e := range entries {
+		if e.ID > after {
+			res = append(res, e)
+		}
+	}
+
+	return res
+}
+
+// lastAuditEntry returns the ID of the latest audit entry.
+func (suite *AdapterTestSuite) lastAuditEntry(adapter *bunadapter.Adapter) int64 {
+	suite.T().Helper()
+
+	entries, err := adapter.AuditHistory(context.Background(), bunadapter.AuditQuery{})
+	suite.Require().NoError(err)
+	if len(entries) == 0 {
+		return 0
+	}
+
+	return entries[len(entries)-1].ID
+}
+
+func (suite *AdapterTestSuite) TestAudit() {
+	adapter, err := bunadapter.NewAdapter(suite.db, bunadapter.WithAudit())
+	suite.Require().NoError(err)
+
+	ctx := bunadapter.ContextWithActor(context.Background(), "admin")
+	after := suite.lastAuditEntry(adapter)
+
+	err = adapter.AddPolicyCtx(ctx, "p", "p", []string{"carol", "data3", "read"})
+	suite.Require().NoError(err)
+	err = adapter.UpdatePolicyCtx(ctx, "p", "p", []string{"carol", "data3", "read"}, []string{"dave", "data3", "write"})
+	suite.Require().NoError(err)
+	err = adapter.RemovePolicyCtx(ctx, "p", "p", []string{"bob", "data2", "write"})
+	suite.Require().NoError(err)
+	err = adapter.RemoveFilteredPolicyCtx(ctx, "p", "p", 0, "data2_admin", "", "read")
+	suite.Require().NoError(err)
+
+	entries := suite.auditHistory(adapter, bunadapter.AuditQuery{}, after)
+	suite.Require().Len(entries, 4)
+	for _, e := range entries {
+		suite.Equal("admin", e.Actor)
+		suite.Equal("p", e.Ptype)
+		suite.False(e.CreatedAt.IsZero())
+	}
+	suite.Equal(bunadapter.AuditAdd, entries[0].Op)
+	suite.Empty(entries[0].OldRule)
+	suite.Equal([]string{"carol", "data3", "read"}, entries[0].NewRule)
+	suite.Equal(bunadapter.AuditUpdate, entries[1].Op)
+	suite.Equal([]string{"carol", "data3", "read"}, entries[1].OldRule)
+	suite.Equal([]string{"dave", "data3", "write"}, entries[1].NewRule)
+	suite.Equal(bunadapter.AuditRemove, entries[2].Op)
+	suite.Equal([]string{"bob", "data2", "write"}, entries[2].OldRule)
+	suite.Empty(entries[2].NewRule)
+	suite.Equal(bunadapter.AuditRemoveFiltered, entries[3].Op)
+	suite.Equal([]string{"data2_admin", "data2", "read"}, entries[3].OldRule)
+
+	// The update is found by its old and its new subject.
+	entries = suite.auditHistory(adapter, bunadapter.AuditQuery{Subject: "carol"}, after)
+	suite.Len(entries, 2)
+	entries = suite.auditHistory(adapter, bunadapter.AuditQuery{Subject: "dave"}, after)
+	suite.Len(entries, 1)
+	entries = suite.auditHistory(adapter, bunadapter.AuditQuery{Object: "data3"}, after)
+	suite.Len(entries, 2)
+
+	entries, err = adapter.AuditHistory(ctx, bunadapter.AuditQuery{Limit: 1})
+	suite.Require().NoError(err)
+	suite.Len(entries, 1)
+}
+
+func (suite *AdapterTestSuite) TestAuditSavePolicy() {
+	adapter, err := bunadapter.NewAdapter(suite.db, bunadapter.WithAudit())
+	suite.Require().NoError(err)
+	enforcer, err := casbin.NewEnforcer("examples/rbac_model.conf", adapter)
+	suite.Require().NoError(err)
+	after := suite.lastAuditEntry(adapter)
+
+	_, err = enforcer.RemovePolicy("alice", "data1", "read")
+	suite.Require().NoError(err)
+	err = enforcer.GetModel().AddPolicy("p", "p", []string{"carol", "data3", "read"})
+	suite.Require().NoError(err)
+	err = enforcer.SavePolicy()
+	suite.Require().NoError(err)
+
+	entries := suite.auditHistory(adapter, bunadapter.AuditQuery{Ptype: "p"}, after)
+	suite.Require().Len(entries, 2)
+	suite.Equal(bunadapter.AuditRemove, entries[0].Op)
+	suite.Equal([]string{"alice", "data1", "read"}, entries[0].OldRule)
+	suite.Equal("", entries[0].Actor)
+	// Only the difference to the stored policy is audited.
+	suite.Equal(bunadapter.AuditSave, entries[1].Op)
+	suite.Equal([]string{"carol", "data3", "read"}, entries[1].NewRule)
+}
+
+func (suite *AdapterTestSuite) TestAuditSkipsUnchangedRules() {
+	adapter, err := bunadapter.NewAdapter(suite.db, bunadapter.WithAudit())
+	suite.Require().NoError(err)
+	ctx := bunadapter.ContextWithActor(context.Background(), "admin")
+	after := suite.lastAuditEntry(adapter)
+
+	// Stored rules are not added again and missing ones are not removed.
+	err = adapter.AddPolicyCtx(ctx, "p", "p", []string{"alice", "data1", "read"})
+	suite.Require().NoError(err)
+	err = adapter.RemovePolicyCtx(ctx, "p", "p", []string{"nobody", "x", "y"})
+	suite.Require().NoError(err)
+	err = adapter.AddPoliciesCtx(ctx, "p", "p", [][]string{{"bob", "data2", "write"}, {"carol", "data3", "read"}})
+	suite.Require().NoError(err)
+
+	entries := suite.auditHistory(adapter, bunadapter.AuditQuery{}, after)
+	suite.Require().Len(entries, 1)
+	suite.Equal(bunadapter.AuditAdd, entries[0].Op)
+	suite.Equal([]string{"carol", "data3", "read"}, entries[0].NewRule)
+}
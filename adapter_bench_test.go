@@ -0,0 +1,115 @@
+package bunadapter_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/uptrace/bun/dialect"
+
+	bunadapter "github.com/msales/casbin-bun-adapter"
+)
+
+const benchRules = 10000
+
+func benchModel(b *testing.B, n int) model.Model {
+	b.Helper()
+
+	m, err := model.NewModelFromFile("examples/rbac_model.conf")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if err := m.AddPolicy("p", "p", []string{fmt.Sprintf("user%d", i), fmt.Sprintf("data%d", i%100), "read"}); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	return m
+}
+
+// benchOptions returns the adapter options of the compared write strategies.
+func benchOptions(b *testing.B, name dialect.Name) map[string][]bunadapter.Option {
+	b.Helper()
+
+	options := map[string][]bunadapter.Option{
+		"row by row": {bunadapter.WithBatchSize(1)},
+		"multi-row":  nil,
+	}
+	if name == dialect.PG {
+		options["copy"] = []bunadapter.Option{bunadapter.WithCopyFrom()}
+	}
+
+	return options
+}
+
+func BenchmarkSavePolicy(b *testing.B) {
+	db := newTestDB(b)
+	defer db.Close()
+
+	if _, err := bunadapter.NewAdapter(db, bunadapter.WithAutoMigrate()); err != nil {
+		b.Fatal(err)
+	}
+	m := benchModel(b, benchRules)
+	empty := benchModel(b, 0)
+
+	for name, opts := range benchOptions(b, db.Dialect().Name()) {
+		b.Run(name, func(b *testing.B) {
+			adapter, err := bunadapter.NewAdapter(db, opts...)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Saves only write the difference, so every save starts from an empty table.
+				b.StopTimer()
+				if err := adapter.SavePolicy(empty); err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+
+				if err := adapter.SavePolicyCtx(context.Background(), m); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkAddPolicies(b *testing.B) {
+	db := newTestDB(b)
+	defer db.Close()
+
+	if _, err := bunadapter.NewAdapter(db, bunadapter.WithAutoMigrate()); err != nil {
+		b.Fatal(err)
+	}
+	rules, err := benchModel(b, benchRules).GetPolicy("p", "p")
+	if err != nil {
+		b.Fatal(err)
+	}
+	empty := benchModel(b, 0)
+
+	for name, opts := range benchOptions(b, db.Dialect().Name()) {
+		b.Run(name, func(b *testing.B) {
+			adapter, err := bunadapter.NewAdapter(db, opts...)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				if err := adapter.SavePolicy(empty); err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+
+				if err := adapter.AddPolicies("p", "p", rules); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package bunadapter_test
+
+import (
+	"context"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+
+	bunadapter "github.com/msales/casbin-bun-adapter"
+)
+
+func (suite *AdapterTestSuite) TestChangeLog() {
+	ctx := context.Background()
+
+	adapter, err := bunadapter.NewAdapter(suite.db, bunadapter.WithChangeLog())
+	suite.Require().NoError(err)
+	enforcer, err := casbin.NewEnforcer("examples/rbac_model.conf", adapter)
+	suite.Require().NoError(err)
+
+	// A replica loads the policy and follows the changes from there on.
+	since, err := adapter.LastChange(ctx)
+	suite.Require().NoError(err)
+	replica, err := model.NewModelFromFile("examples/rbac_model.conf")
+	suite.Require().NoError(err)
+	err = adapter.LoadPolicy(replica)
+	suite.Require().NoError(err)
+
+	_, err = enforcer.AddPolicies([][]string{{"carol", "data3", "read"}, {"carol", "data3", "write"}})
+	suite.Require().NoError(err)
+	_, err = enforcer.RemovePolicy("bob", "data2", "write")
+	suite.Require().NoError(err)
+	_, err = enforcer.UpdatePolicy([]string{"alice", "data1", "read"}, []string{"alice", "data1", "write"})
+	suite.Require().NoError(err)
+	_, err = enforcer.RemoveFilteredPolicy(1, "data3", "write")
+	suite.Require().NoError(err)
+	_, err = enforcer.AddGroupingPolicy("carol", "data2_admin")
+	suite.Require().NoError(err)
+
+	changes, err := adapter.Changes(ctx, since)
+	suite.Require().NoError(err)
+	ops := make([]bunadapter.ChangeOp, 0, len(changes))
+	for _, c := range changes {
+		ops = append(ops, c.Op)
+	}
+	suite.Equal([]bunadapter.ChangeOp{
+		bunadapter.ChangeAdd, bunadapter.ChangeAdd,
+		bunadapter.ChangeRemove,
+		bunadapter.ChangeRemove, bunadapter.ChangeAdd,
+		bunadapter.ChangeRemove,
+		bunadapter.ChangeAdd,
+	}, ops)
+	suite.Equal("g", changes[6].Ptype)
+	suite.Equal([]string{"carol", "data2_admin"}, changes[6].Rule)
+
+	last, err := adapter.LoadChanges(ctx, replica, since)
+	suite.Require().NoError(err)
+	suite.Equal(changes[6].Seq, last)
+
+	policies, err := replica.GetPolicy("p", "p")
+	suite.Require().NoError(err)
+	suite.ElementsMatch([][]string{
+		{"alice", "data1", "write"},
+		{"carol", "data3", "read"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"},
+	}, policies)
+	policies, err = replica.GetPolicy("g", "g")
+	suite.Require().NoError(err)
+	suite.ElementsMatch([][]string{{"alice", "data2_admin"}, {"carol", "data2_admin"}}, policies)
+
+	// Nothing new to apply.
+	seq, err := adapter.LoadChanges(ctx, replica, last)
+	suite.Require().NoError(err)
+	suite.Equal(last, seq)
+
+	err = adapter.PruneChanges(ctx, last)
+	suite.Require().NoError(err)
+	changes, err = adapter.Changes(ctx, 0)
+	suite.Require().NoError(err)
+	suite.Empty(changes)
+}
+
+func (suite *AdapterTestSuite) TestChangeLogAfterPrune() {
+	ctx := context.Background()
+
+	adapter, err := bunadapter.NewAdapter(suite.db, bunadapter.WithChangeLog())
+	suite.Require().NoError(err)
+
+	err = adapter.AddPolicy("p", "p", []string{"carol", "data3", "read"})
+	suite.Require().NoError(err)
+	last, err := adapter.LastChange(ctx)
+	suite.Require().NoError(err)
+	suite.Require().NotZero(last)
+
+	// Pruning every change must not make the next change reuse a sequence number.
+	err = adapter.PruneChanges(ctx, last)
+	suite.Require().NoError(err)
+	seq, err := adapter.LastChange(ctx)
+	suite.Require().NoError(err)
+	suite.Equal(last, seq)
+
+	err = adapter.AddPolicy("p", "p", []string{"carol", "data3", "write"})
+	suite.Require().NoError(err)
+
+	changes, err := adapter.Changes(ctx, last)
+	suite.Require().NoError(err)
+	suite.Require().Len(changes, 1)
+	suite.Equal(last+1, changes[0].Seq)
+	suite.Equal([]string{"carol", "data3", "write"}, changes[0].Rule)
+}
+
+func (suite *AdapterTestSuite) TestChangeLogSavePolicy() {
+	ctx := context.Background()
+
+	adapter, err := bunadapter.NewAdapter(suite.db, bunadapter.WithChangeLog())
+	suite.Require().NoError(err)
+
+	since, err := adapter.LastChange(ctx)
+	suite.Require().NoError(err)
+	replica, err := model.NewModelFromFile("examples/rbac_model.conf")
+	suite.Require().NoError(err)
+	err = adapter.LoadPolicy(replica)
+	suite.Require().NoError(err)
+
+	m, err := model.NewModelFromFile("examples/rbac_model.conf")
+	suite.Require().NoError(err)
+	err = m.AddPolicy("p", "p", []string{"carol", "data3", "read"})
+	suite.Require().NoError(err)
+	err = adapter.SavePolicy(m)
+	suite.Require().NoError(err)
+
+	_, err = adapter.LoadChanges(ctx, replica, since)
+	suite.Require().NoError(err)
+
+	policies, err := replica.GetPolicy("p", "p")
+	suite.Require().NoError(err)
+	suite.Equal([][]string{{"carol", "data3", "read"}}, policies)
+	policies, err = replica.GetPolicy("g", "g")
+	suite.Require().NoError(err)
+	suite.Empty(policies)
+}
+
+func (suite *AdapterTestSuite) TestSavePolicyWritesDifference() {
+	ctx := context.Background()
+
+	adapter, err := bunadapter.NewAdapter(suite.db, bunadapter.WithChangeLog())
+	suite.Require().NoError(err)
+	enforcer, err := casbin.NewEnforcer("examples/rbac_model.conf", adapter)
+	suite.Require().NoError(err)
+	enforcer.EnableAutoSave(false)
+
+	since, err := adapter.LastChange(ctx)
+	suite.Require().NoError(err)
+
+	_, err = enforcer.AddPolicy("carol", "data3", "read")
+	suite.Require().NoError(err)
+	_, err = enforcer.RemovePolicy("bob", "data2", "write")
+	suite.Require().NoError(err)
+	err = enforcer.SavePolicy()
+	suite.Require().NoError(err)
+
+	// Unchanged rules are kept, only the difference is written.
+	changes, err := adapter.Changes(ctx, since)
+	suite.Require().NoError(err)
+	suite.Require().Len(changes, 2)
+	suite.Equal(bunadapter.ChangeRemove, changes[0].Op)
+	suite.Equal([]string{"bob", "data2", "write"}, changes[0].Rule)
+	suite.Equal(bunadapter.ChangeAdd, changes[1].Op)
+	suite.Equal([]string{"carol", "data3", "read"}, changes[1].Rule)
+
+	err = enforcer.LoadPolicy()
+	suite.Require().NoError(err)
+	suite.enforcer = enforcer
+	suite.assertEnforcerPolicy([][]string{
+		{"alice", "data1", "read"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"},
+		{"carol", "data3", "read"},
+	})
+
+	// Saving the same policy again writes nothing.
+	err = enforcer.SavePolicy()
+	suite.Require().NoError(err)
+	changes, err = adapter.Changes(ctx, changes[1].Seq)
+	suite.Require().NoError(err)
+	suite.Empty(changes)
+}
+
+func (suite *AdapterTestSuite) TestChangeLogSkipsUnchangedRules() {
+	ctx := context.Background()
+
+	adapter, err := bunadapter.NewAdapter(suite.db, bunadapter.WithChangeLog())
+	suite.Require().NoError(err)
+	since, err := adapter.LastChange(ctx)
+	suite.Require().NoError(err)
+
+	// Stored rules are not added again and missing ones are not removed.
+	err = adapter.AddPolicies("p", "p", [][]string{{"alice", "data1", "read"}, {"carol", "data3", "read"}})
+	suite.Require().NoError(err)
+	err = adapter.RemovePolicy("p", "p", []string{"nobody", "data3", "read"})
+	suite.Require().NoError(err)
+	err = adapter.RemovePolicies("p", "p", [][]string{{"bob", "data2", "write"}, {"nobody", "data3", "write"}})
+	suite.Require().NoError(err)
+
+	changes, err := adapter.Changes(ctx, since)
+	suite.Require().NoError(err)
+	suite.Require().Len(changes, 2)
+	suite.Equal(bunadapter.ChangeAdd, changes[0].Op)
+	suite.Equal([]string{"carol", "data3", "read"}, changes[0].Rule)
+	suite.Equal(bunadapter.ChangeRemove, changes[1].Op)
+	suite.Equal([]string{"bob", "data2", "write"}, changes[1].Rule)
+}
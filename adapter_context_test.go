@@ -0,0 +1,65 @@
+package bunadapter_test
+
+import (
+	"context"
+
+	"github.com/casbin/casbin/v2/model"
+)
+
+func (suite *AdapterTestSuite) TestLoadPolicyCtxCanceled() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	m, err := model.NewModelFromFile("examples/rbac_model.conf")
+	suite.Require().NoError(err)
+
+	err = suite.adapter.LoadPolicyCtx(ctx, m)
+	suite.Require().ErrorIs(err, context.Canceled)
+}
+
+func (suite *AdapterTestSuite) TestAddPolicyCtxCanceled() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := suite.adapter.AddPolicyCtx(ctx, "p", "p", []string{"alice", "data1", "write"})
+	suite.Require().ErrorIs(err, context.Canceled)
+
+	err = suite.enforcer.LoadPolicy()
+	suite.Require().NoError(err)
+	suite.assertEnforcerPolicy([][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"},
+	})
+}
+
+func (suite *AdapterTestSuite) TestPolicyCtx() {
+	ctx := context.Background()
+
+	err := suite.adapter.AddPoliciesCtx(ctx, "p", "p", [][]string{
+		{"alice", "data1", "write"},
+		{"bob", "data1", "read"},
+	})
+	suite.Require().NoError(err)
+
+	err = suite.adapter.RemovePolicyCtx(ctx, "p", "p", []string{"bob", "data2", "write"})
+	suite.Require().NoError(err)
+
+	err = suite.adapter.UpdatePolicyCtx(ctx, "p", "p", []string{"bob", "data1", "read"}, []string{"bob", "data1", "write"})
+	suite.Require().NoError(err)
+
+	m, err := model.NewModelFromFile("examples/rbac_model.conf")
+	suite.Require().NoError(err)
+	err = suite.adapter.LoadPolicyCtx(ctx, m)
+	suite.Require().NoError(err)
+	suite.enforcer.SetModel(m)
+
+	suite.assertEnforcerPolicy([][]string{
+		{"alice", "data1", "read"},
+		{"alice", "data1", "write"},
+		{"bob", "data1", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"},
+	})
+}
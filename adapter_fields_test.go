@@ -0,0 +1,144 @@
+package bunadapter_test
+
+import (
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+
+	bunadapter "github.com/msales/casbin-bun-adapter"
+)
+
+const wideModel = `
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act, f3, f4, f5, f6, f7, f8, f9
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == p.sub && r.obj == p.obj && r.act == p.act
+`
+
+func (suite *AdapterTestSuite) TestTooManyFields() {
+	err := suite.adapter.AddPolicy("p", "p", []string{"a", "b", "c", "d", "e", "f", "g"})
+	suite.ErrorIs(err, bunadapter.ErrTooManyFields)
+
+	err = suite.adapter.RemoveFilteredPolicy("p", "p", 6, "g")
+	suite.ErrorIs(err, bunadapter.ErrTooManyFields)
+
+	err = suite.enforcer.LoadFilteredPolicy(&bunadapter.Filter{P: []string{"", "", "", "", "", "", "g"}})
+	suite.ErrorIs(err, bunadapter.ErrTooManyFields)
+}
+
+func (suite *AdapterTestSuite) TestMoreThanSixFields() {
+	adapter, err := bunadapter.NewAdapter(suite.db, bunadapter.WithColumnCount(10))
+	suite.Require().NoError(err)
+
+	m, err := model.NewModelFromString(wideModel)
+	suite.Require().NoError(err)
+	enforcer, err := casbin.NewEnforcer(m, adapter)
+	suite.Require().NoError(err)
+	enforcer.ClearPolicy()
+	err = enforcer.SavePolicy()
+	suite.Require().NoError(err)
+
+	_, err = enforcer.AddPolicies([][]string{
+		{"alice", "data1", "read", "3", "4", "5", "6", "7", "8", "9"},
+		{"bob", "data2", "write", "3", "4", "5", "6", "7", "8", "x"},
+	})
+	suite.Require().NoError(err)
+
+	err = enforcer.LoadFilteredPolicy(&bunadapter.Filter{P: []string{"", "", "", "", "", "", "", "", "", "9"}})
+	suite.Require().NoError(err)
+	policies, err := enforcer.GetPolicy()
+	suite.Require().NoError(err)
+	suite.Equal([][]string{{"alice", "data1", "read", "3", "4", "5", "6", "7", "8", "9"}}, policies)
+
+	err = adapter.RemoveFilteredPolicy("p", "p", 9, "x")
+	suite.Require().NoError(err)
+
+	_, err = enforcer.UpdatePolicy(
+		[]string{"alice", "data1", "read", "3", "4", "5", "6", "7", "8", "9"},
+		[]string{"alice", "data1", "write", "3", "4", "5", "6", "7", "8", "9"},
+	)
+	suite.Require().NoError(err)
+
+	err = enforcer.LoadPolicy()
+	suite.Require().NoError(err)
+	policies, err = enforcer.GetPolicy()
+	suite.Require().NoError(err)
+	suite.Equal([][]string{{"alice", "data1", "write", "3", "4", "5", "6", "7", "8", "9"}}, policies)
+}
+
+func (suite *AdapterTestSuite) TestEmptyFields() {
+	_, err := suite.enforcer.AddPolicies([][]string{
+		{"alice", "", "read"},
+		{"bob", "data1", ""},
+	})
+	suite.Require().NoError(err)
+
+	err = suite.enforcer.SavePolicy()
+	suite.Require().NoError(err)
+	err = suite.enforcer.LoadPolicy()
+	suite.Require().NoError(err)
+	suite.assertEnforcerPolicy([][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"},
+		{"alice", "", "read"},
+		{"bob", "data1", ""},
+	})
+
+	removed, err := suite.adapter.UpdateFilteredPolicies("p", "p", [][]string{{"alice", "data3", "read"}}, 0, "alice", "", "read")
+	suite.Require().NoError(err)
+	// Empty filter values match any value, rules are returned without ptype.
+	suite.ElementsMatch([][]string{{"alice", "data1", "read"}, {"alice", "", "read"}}, removed)
+}
+
+func (suite *AdapterTestSuite) TestPunctuationValues() {
+	rules := [][]string{
+		{"alice", "data1, data2", "read"},
+		{"bob", `"quoted"`, "write"},
+		{"carol", `{"owner": "carol", "tags": ["a", "b"]}`, "read"},
+		{"dave", `a,"b",c`, `'single'`},
+	}
+	_, err := suite.enforcer.AddPolicies(rules)
+	suite.Require().NoError(err)
+
+	err = suite.enforcer.LoadPolicy()
+	suite.Require().NoError(err)
+	suite.assertEnforcerPolicy(append([][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"},
+	}, rules...))
+
+	ok, err := suite.enforcer.Enforce("carol", `{"owner": "carol", "tags": ["a", "b"]}`, "read")
+	suite.Require().NoError(err)
+	suite.True(ok)
+
+	err = suite.enforcer.LoadFilteredPolicy(&bunadapter.Filter{P: []string{"", "data1, data2"}})
+	suite.Require().NoError(err)
+	suite.assertEnforcerPolicy([][]string{{"alice", "data1, data2", "read"}})
+}
+
+func (suite *AdapterTestSuite) TestCommaPositions() {
+	// Casbin models key rules by their comma joined values, so each rule is loaded on its own.
+	err := suite.adapter.AddPolicies("p", "p", [][]string{
+		{"alice", "data,1", "read"},
+		{"alice", "data", "1,read"},
+	})
+	suite.Require().NoError(err)
+
+	err = suite.enforcer.LoadFilteredPolicy(&bunadapter.Filter{P: []string{"alice", "data,1"}})
+	suite.Require().NoError(err)
+	suite.assertEnforcerPolicy([][]string{{"alice", "data,1", "read"}})
+
+	err = suite.enforcer.LoadFilteredPolicy(&bunadapter.Filter{P: []string{"alice", "data"}})
+	suite.Require().NoError(err)
+	suite.assertEnforcerPolicy([][]string{{"alice", "data", "1,read"}})
+}
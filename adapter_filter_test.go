@@ -0,0 +1,113 @@
+package bunadapter_test
+
+import (
+	"github.com/casbin/casbin/v2/model"
+
+	bunadapter "github.com/msales/casbin-bun-adapter"
+)
+
+func (suite *AdapterTestSuite) TestLoadQueryFilteredPolicy() {
+	_, err := suite.enforcer.AddPolicies([][]string{
+		{"carol", "tenant42/data1", "read"},
+		{"carol", "tenant42/data2", ""},
+		{"dave", "tenant4_/data1", "read"},
+		{"dave", "tenant4*/data1", "read"},
+		{"dave", "tenant[4]/data1", "read"},
+		{"dave", "TENANT42/doc", "read"},
+	})
+	suite.Require().NoError(err)
+
+	tests := map[string]struct {
+		filter *bunadapter.QueryFilter
+		want   [][]string
+	}{
+		"in": {
+			filter: &bunadapter.QueryFilter{P: []bunadapter.Matcher{bunadapter.In("alice", "bob")}},
+			want:   [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}},
+		},
+		"empty in": {
+			filter: &bunadapter.QueryFilter{P: []bunadapter.Matcher{bunadapter.In()}},
+			want:   [][]string{},
+		},
+		"prefix": {
+			filter: &bunadapter.QueryFilter{P: []bunadapter.Matcher{bunadapter.Any(), bunadapter.Prefix("tenant42/")}},
+			want:   [][]string{{"carol", "tenant42/data1", "read"}, {"carol", "tenant42/data2", ""}},
+		},
+		"prefix with wildcard": {
+			filter: &bunadapter.QueryFilter{P: []bunadapter.Matcher{bunadapter.Any(), bunadapter.Prefix("tenant4_")}},
+			want:   [][]string{{"dave", "tenant4_/data1", "read"}},
+		},
+		"prefix with glob wildcard": {
+			filter: &bunadapter.QueryFilter{P: []bunadapter.Matcher{bunadapter.Any(), bunadapter.Prefix("tenant4*")}},
+			want:   [][]string{{"dave", "tenant4*/data1", "read"}},
+		},
+		"prefix with bracket": {
+			filter: &bunadapter.QueryFilter{P: []bunadapter.Matcher{bunadapter.Any(), bunadapter.Prefix("tenant[4]")}},
+			want:   [][]string{{"dave", "tenant[4]/data1", "read"}},
+		},
+		"prefix is case-sensitive": {
+			filter: &bunadapter.QueryFilter{P: []bunadapter.Matcher{bunadapter.Any(), bunadapter.Prefix("TENANT")}},
+			want:   [][]string{{"dave", "TENANT42/doc", "read"}},
+		},
+		"not": {
+			filter: &bunadapter.QueryFilter{P: []bunadapter.Matcher{
+				bunadapter.Not(bunadapter.In("carol", "dave")),
+				bunadapter.Not(bunadapter.Eq("data1")),
+			}},
+			want: [][]string{{"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}},
+		},
+		"empty": {
+			filter: &bunadapter.QueryFilter{P: []bunadapter.Matcher{{}, {}, bunadapter.Empty()}},
+			want:   [][]string{{"carol", "tenant42/data2", ""}},
+		},
+		"not empty": {
+			filter: &bunadapter.QueryFilter{P: []bunadapter.Matcher{bunadapter.Eq("carol"), {}, bunadapter.Not(bunadapter.Empty())}},
+			want:   [][]string{{"carol", "tenant42/data1", "read"}},
+		},
+	}
+
+	for name, tt := range tests {
+		err := suite.enforcer.LoadFilteredPolicy(tt.filter)
+		suite.Require().NoError(err, name)
+		suite.True(suite.enforcer.IsFiltered(), name)
+		suite.assertEnforcerPolicy(tt.want)
+	}
+}
+
+func (suite *AdapterTestSuite) TestLoadQueryFilteredGroupingPolicy() {
+	err := suite.enforcer.LoadFilteredPolicy(&bunadapter.QueryFilter{
+		Ptypes: map[string][]bunadapter.Matcher{"g": {bunadapter.Prefix("ali")}},
+	})
+	suite.Require().NoError(err)
+	suite.assertEnforcerPolicy([][]string{})
+	suite.assertEnforcerGroupingPolicy([][]string{{"alice", "data2_admin"}})
+
+	err = suite.enforcer.LoadFilteredPolicy(&bunadapter.QueryFilter{
+		P: []bunadapter.Matcher{{}, {}, {}, {}, {}, {}, bunadapter.Empty()},
+	})
+	suite.ErrorIs(err, bunadapter.ErrTooManyFields)
+}
+
+func (suite *AdapterTestSuite) TestLoadFilteredPolicies() {
+	m, err := model.NewModelFromFile("examples/rbac_model.conf")
+	suite.Require().NoError(err)
+
+	err = suite.adapter.LoadFilteredPolicies(m, []*bunadapter.Filter{
+		{P: []string{"alice"}},
+		{P: []string{"", "data1"}, G: []string{"alice"}},
+		{P: []string{"data2_admin", "", "write"}},
+	})
+	suite.Require().NoError(err)
+	suite.True(suite.adapter.IsFiltered())
+
+	policies, err := m.GetPolicy("p", "p")
+	suite.Require().NoError(err)
+	suite.ElementsMatch([][]string{{"alice", "data1", "read"}, {"data2_admin", "data2", "write"}}, policies)
+
+	policies, err = m.GetPolicy("g", "g")
+	suite.Require().NoError(err)
+	suite.Equal([][]string{{"alice", "data2_admin"}}, policies)
+
+	err = suite.adapter.LoadFilteredPolicies(m, []*bunadapter.Filter{nil})
+	suite.Error(err)
+}
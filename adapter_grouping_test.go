@@ -71,3 +71,36 @@ func (suite *AdapterTestSuite) TestAddNewHierarchicalGroupingPolicy() {
 		{"data1_admin", "data1", "write"},
 	})
 }
+
+func (suite *AdapterTestSuite) TestLoadFilteredNamedGroupingPolicy() {
+	_, err := suite.enforcer.AddNamedGroupingPolicies("g2", [][]string{
+		{"alice", "admins"},
+		{"bob", "admins"},
+	})
+	suite.Require().NoError(err)
+
+	err = suite.enforcer.LoadFilteredPolicy(&bunadapter.Filter{
+		P:      []string{"", "data1"},
+		Ptypes: map[string][]string{"g2": {"alice"}},
+	})
+	suite.Require().NoError(err)
+	suite.Assert().True(suite.enforcer.IsFiltered())
+	suite.assertEnforcerPolicy([][]string{{"alice", "data1", "read"}})
+	suite.assertEnforcerGroupingPolicy([][]string{})
+
+	policies, err := suite.enforcer.GetNamedGroupingPolicy("g2")
+	suite.Require().NoError(err)
+	suite.Equal([][]string{{"alice", "admins"}}, policies)
+
+	err = suite.enforcer.LoadFilteredPolicy(&bunadapter.Filter{
+		G:      []string{"bob"},
+		Ptypes: map[string][]string{"g": {"alice"}, "g2": nil},
+	})
+	suite.Require().NoError(err)
+	suite.assertEnforcerPolicy([][]string{})
+	suite.assertEnforcerGroupingPolicy([][]string{{"alice", "data2_admin"}})
+
+	policies, err = suite.enforcer.GetNamedGroupingPolicy("g2")
+	suite.Require().NoError(err)
+	suite.ElementsMatch([][]string{{"alice", "admins"}, {"bob", "admins"}}, policies)
+}
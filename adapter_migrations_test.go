@@ -0,0 +1,158 @@
+package bunadapter_test
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/mmcloughlin/meow"
+
+	bunadapter "github.com/msales/casbin-bun-adapter"
+)
+
+func (suite *AdapterTestSuite) TestMigrate() {
+	ctx := context.Background()
+
+	err := suite.adapter.Migrate(ctx)
+	suite.Require().NoError(err)
+
+	// Applied migrations are recorded and not run again.
+	err = suite.adapter.Migrate(ctx)
+	suite.Require().NoError(err)
+
+	var names []string
+	err = suite.db.NewSelect().
+		ColumnExpr("name").
+		TableExpr("casbin.casbin_rules_migrations").
+		OrderExpr("name").
+		Scan(ctx, &names)
+	suite.Require().NoError(err)
+	suite.Equal([]string{
+		"20230601000000_create_rules_table",
+		"20230601000001_create_rules_indexes",
+		"20230601000002_add_value_columns",
+		"20230601000003_add_field_count_column",
+		"20230601000004_create_changes_table",
+		"20230601000005_create_audit_table",
+		"20230601000006_create_snapshot_tables",
+		"20230601000007_rehash_rule_ids",
+		"20230601000008_create_changes_lock_table",
+		"20230601000009_sync_changes_lock_version",
+	}, names)
+
+	// Existing rules are kept.
+	err = suite.enforcer.LoadPolicy()
+	suite.Require().NoError(err)
+	suite.assertEnforcerPolicy([][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"},
+	})
+}
+
+func (suite *AdapterTestSuite) TestMigrateExistingTable() {
+	ctx := context.Background()
+
+	_, err := suite.db.NewCreateTable().
+		Model((*legacyCasbinRule)(nil)).
+		ModelTableExpr("casbin.legacy_rules").
+		IfNotExists().
+		Exec(ctx)
+	suite.Require().NoError(err)
+
+	// The ID HashIDStrategy generated before it length-prefixed values, and one of a custom strategy.
+	sum := meow.Checksum(0, []byte("p,carol,data3,read"))
+	_, err = suite.db.NewInsert().
+		Model(&[]*legacyCasbinRule{
+			{ID: fmt.Sprintf("%x", sum), Ptype: "p", V0: "carol", V1: "data3", V2: "read"},
+			{ID: "custom", Ptype: "p", V0: "erin", V1: "data4", V2: "read"},
+		}).
+		ModelTableExpr("casbin.legacy_rules").
+		On("CONFLICT DO NOTHING").
+		Exec(ctx)
+	suite.Require().NoError(err)
+
+	// The migrating adapter's ID strategy does not matter.
+	adapter, err := bunadapter.NewAdapter(suite.db,
+		bunadapter.WithTableName("legacy_rules"),
+		bunadapter.WithIDStrategy(func(string, []string) string { return "other" }),
+	)
+	suite.Require().NoError(err)
+	err = adapter.Migrate(ctx)
+	suite.Require().NoError(err)
+
+	// Value columns added by the migration can be used.
+	adapter, err = bunadapter.NewAdapter(suite.db,
+		bunadapter.WithTableName("legacy_rules"),
+		bunadapter.WithColumnCount(8),
+	)
+	suite.Require().NoError(err)
+	err = adapter.AddPolicy("p", "p", []string{"dave", "data3", "read", "", "", "", "", "eighth"})
+	suite.Require().NoError(err)
+
+	m, err := model.NewModelFromFile("examples/rbac_model.conf")
+	suite.Require().NoError(err)
+	err = adapter.LoadPolicy(m)
+	suite.Require().NoError(err)
+	suite.True(m.HasPolicy("p", "p", []string{"carol", "data3", "read"}))
+
+	// Other IDs are kept whatever the ID strategy of the migrating adapter.
+	var id string
+	err = suite.db.NewSelect().
+		ColumnExpr("id").
+		TableExpr("casbin.legacy_rules").
+		Where("v0 = ?", "erin").
+		Scan(ctx, &id)
+	suite.Require().NoError(err)
+	suite.Equal("custom", id)
+
+	// The old hash is replaced by the current one, so the rule can be removed.
+	err = adapter.RemovePolicy("p", "p", []string{"carol", "data3", "read"})
+	suite.Require().NoError(err)
+	m, err = model.NewModelFromFile("examples/rbac_model.conf")
+	suite.Require().NoError(err)
+	err = adapter.LoadPolicy(m)
+	suite.Require().NoError(err)
+	suite.False(m.HasPolicy("p", "p", []string{"carol", "data3", "read"}))
+}
+
+func (suite *AdapterTestSuite) TestMigrateModelTable() {
+	ctx := context.Background()
+
+	// Tables created from the current model have the columns added by migrations already.
+	_, err := suite.db.NewCreateTable().
+		Model((*bunadapter.CasbinRule)(nil)).
+		ModelTableExpr("casbin.model_rules").
+		IfNotExists().
+		Exec(ctx)
+	suite.Require().NoError(err)
+
+	adapter, err := bunadapter.NewAdapter(suite.db,
+		bunadapter.WithTableName("model_rules"),
+		bunadapter.WithColumnCount(10),
+		bunadapter.WithAutoMigrate(),
+	)
+	suite.Require().NoError(err)
+
+	rule := []string{"dave", "data3", "read", "", "", "", "", "", "", "tenth"}
+	err = adapter.AddPolicy("p", "p", rule)
+	suite.Require().NoError(err)
+	m, err := model.NewModelFromString(wideModel)
+	suite.Require().NoError(err)
+	err = adapter.LoadPolicy(m)
+	suite.Require().NoError(err)
+	suite.True(m.HasPolicy("p", "p", rule))
+}
+
+// legacyCasbinRule is the policy table created before migrations were introduced.
+type legacyCasbinRule struct {
+	ID    string `bun:",pk"`
+	Ptype string
+	V0    string
+	V1    string
+	V2    string
+	V3    string
+	V4    string
+	V5    string
+}
@@ -0,0 +1,451 @@
+package bunadapter_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	bunadapter "github.com/msales/casbin-bun-adapter"
+)
+
+func (suite *AdapterTestSuite) TestCustomTableName() {
+	_, err := suite.db.NewCreateTable().
+		Model((*bunadapter.CasbinRule)(nil)).
+		ModelTableExpr("casbin.custom_rules").
+		IfNotExists().
+		Exec(context.Background())
+	suite.Require().NoError(err)
+
+	adapter, err := bunadapter.NewAdapter(suite.db,
+		bunadapter.WithSchema("casbin"),
+		bunadapter.WithTableName("custom_rules"),
+		bunadapter.WithTableAlias("custom"),
+	)
+	suite.Require().NoError(err)
+
+	enforcer, err := casbin.NewEnforcer("examples/rbac_model.conf", adapter)
+	suite.Require().NoError(err)
+	err = enforcer.SavePolicy()
+	suite.Require().NoError(err)
+
+	_, err = enforcer.AddPolicy("carol", "data3", "read")
+	suite.Require().NoError(err)
+
+	// The default table is left untouched.
+	err = suite.enforcer.LoadPolicy()
+	suite.Require().NoError(err)
+	suite.assertEnforcerPolicy([][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"},
+	})
+
+	err = enforcer.LoadPolicy()
+	suite.Require().NoError(err)
+	policies, err := enforcer.GetPolicy()
+	suite.Require().NoError(err)
+	suite.Equal([][]string{{"carol", "data3", "read"}}, policies)
+
+	_, err = enforcer.RemovePolicy("carol", "data3", "read")
+	suite.Require().NoError(err)
+	err = enforcer.LoadPolicy()
+	suite.Require().NoError(err)
+	policies, err = enforcer.GetPolicy()
+	suite.Require().NoError(err)
+	suite.Empty(policies)
+}
+
+func (suite *AdapterTestSuite) TestInvalidOptions() {
+	options := map[string]bunadapter.Option{
+		"empty table name":  bunadapter.WithTableName(""),
+		"empty table alias": bunadapter.WithTableAlias(""),
+		"zero column count": bunadapter.WithColumnCount(0),
+		"nil logger":        bunadapter.WithLogger(nil),
+		"nil id strategy":   bunadapter.WithIDStrategy(nil),
+		"zero batch size":   bunadapter.WithBatchSize(0),
+		"negative page":     bunadapter.WithPageSize(-1),
+		"negative timeout":  bunadapter.WithQueryTimeout(-time.Second),
+	}
+
+	for name, opt := range options {
+		_, err := bunadapter.NewAdapter(suite.db, opt)
+		suite.Error(err, name)
+	}
+
+	_, err := bunadapter.NewAdapter(nil)
+	suite.Error(err)
+}
+
+// mysqlDialect is a dialect named MySQL, the adapter rejects it before running any query.
+type mysqlDialect struct {
+	*sqlitedialect.Dialect
+}
+
+func (mysqlDialect) Name() dialect.Name { return dialect.MySQL }
+
+func (suite *AdapterTestSuite) TestUnsupportedDialect() {
+	db := bun.NewDB(suite.db.DB, mysqlDialect{sqlitedialect.New()})
+
+	_, err := bunadapter.NewAdapter(db)
+	suite.ErrorIs(err, bunadapter.ErrUnsupportedDialect)
+}
+
+func (suite *AdapterTestSuite) TestAutoMigrate() {
+	adapter, err := bunadapter.NewAdapter(suite.db,
+		bunadapter.WithTableName("migrated_rules"),
+		bunadapter.WithAutoMigrate(),
+	)
+	suite.Require().NoError(err)
+
+	enforcer, err := casbin.NewEnforcer("examples/rbac_model.conf", adapter)
+	suite.Require().NoError(err)
+	err = enforcer.SavePolicy()
+	suite.Require().NoError(err)
+
+	_, err = enforcer.AddPolicy("carol", "data3", "read")
+	suite.Require().NoError(err)
+	err = enforcer.LoadPolicy()
+	suite.Require().NoError(err)
+	policies, err := enforcer.GetPolicy()
+	suite.Require().NoError(err)
+	suite.Equal([][]string{{"carol", "data3", "read"}}, policies)
+}
+
+func (suite *AdapterTestSuite) TestIDStrategy() {
+	adapter, err := bunadapter.NewAdapter(suite.db, bunadapter.WithIDStrategy(func(ptype string, rule []string) string {
+		return ptype + ":" + strings.Join(rule, ":")
+	}))
+	suite.Require().NoError(err)
+
+	err = adapter.AddPolicy("p", "p", []string{"carol", "data3", "read"})
+	suite.Require().NoError(err)
+
+	exists, err := suite.db.NewSelect().
+		Model((*bunadapter.CasbinRule)(nil)).
+		Where("id = ?", "p:carol:data3:read").
+		Exists(context.Background())
+	suite.Require().NoError(err)
+	suite.True(exists)
+
+	err = adapter.RemovePolicy("p", "p", []string{"carol", "data3", "read"})
+	suite.Require().NoError(err)
+	err = suite.enforcer.LoadPolicy()
+	suite.Require().NoError(err)
+	suite.assertEnforcerPolicy([][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"},
+	})
+}
+
+func (suite *AdapterTestSuite) TestColumnCount() {
+	adapter, err := bunadapter.NewAdapter(suite.db, bunadapter.WithColumnCount(3))
+	suite.Require().NoError(err)
+	suite.enforcer.SetAdapter(adapter)
+
+	err = suite.enforcer.LoadPolicy()
+	suite.Require().NoError(err)
+	suite.assertEnforcerPolicy([][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"},
+	})
+
+	err = suite.enforcer.LoadFilteredPolicy(&bunadapter.Filter{P: []string{"", "", "", "read"}})
+	suite.Error(err)
+}
+
+func (suite *AdapterTestSuite) TestQueryTimeout() {
+	adapter, err := bunadapter.NewAdapter(suite.db, bunadapter.WithQueryTimeout(time.Nanosecond))
+	suite.Require().NoError(err)
+
+	m, err := model.NewModelFromFile("examples/rbac_model.conf")
+	suite.Require().NoError(err)
+
+	err = adapter.LoadPolicy(m)
+	suite.ErrorIs(err, context.DeadlineExceeded)
+}
+
+func (suite *AdapterTestSuite) TestBatchSize() {
+	adapter, err := bunadapter.NewAdapter(suite.db, bunadapter.WithBatchSize(2))
+	suite.Require().NoError(err)
+	suite.enforcer.SetAdapter(adapter)
+
+	_, err = suite.enforcer.AddPolicies([][]string{
+		{"carol", "data1", "read"},
+		{"carol", "data2", "read"},
+		{"carol", "data3", "read"},
+		{"carol", "data4", "read"},
+		{"carol", "data5", "read"},
+	})
+	suite.Require().NoError(err)
+	err = adapter.AddPolicies("p", "p", [][]string{{"alice", "data1", "read"}, {"carol", "data6", "read"}})
+	suite.Require().NoError(err)
+
+	err = suite.enforcer.LoadPolicy()
+	suite.Require().NoError(err)
+	suite.assertEnforcerPolicy([][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"},
+		{"carol", "data1", "read"},
+		{"carol", "data2", "read"},
+		{"carol", "data3", "read"},
+		{"carol", "data4", "read"},
+		{"carol", "data5", "read"},
+		{"carol", "data6", "read"},
+	})
+
+	err = suite.enforcer.SavePolicy()
+	suite.Require().NoError(err)
+	err = suite.enforcer.LoadPolicy()
+	suite.Require().NoError(err)
+	policies, err := suite.enforcer.GetPolicy()
+	suite.Require().NoError(err)
+	suite.Len(policies, 10)
+}
+
+func (suite *AdapterTestSuite) TestCopyFrom() {
+	if suite.db.Dialect().Name() != dialect.PG {
+		_, err := bunadapter.NewAdapter(suite.db, bunadapter.WithCopyFrom())
+		suite.Error(err)
+
+		return
+	}
+
+	adapter, err := bunadapter.NewAdapter(suite.db, bunadapter.WithCopyFrom())
+	suite.Require().NoError(err)
+	suite.enforcer.SetAdapter(adapter)
+
+	rules := [][]string{
+		{"carol", "data1\twith\ttabs", "read"},
+		{"carol", `back\slash`, "read"},
+		{"carol", "new\nline", ""},
+	}
+	_, err = suite.enforcer.AddPolicies(rules)
+	suite.Require().NoError(err)
+	err = adapter.AddPolicies("p", "p", [][]string{{"alice", "data1", "read"}})
+	suite.Require().NoError(err)
+
+	err = suite.enforcer.SavePolicy()
+	suite.Require().NoError(err)
+	err = suite.enforcer.LoadPolicy()
+	suite.Require().NoError(err)
+	suite.assertEnforcerPolicy(append([][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"},
+	}, rules...))
+}
+
+func (suite *AdapterTestSuite) TestPageSize() {
+	for _, n := range []int{0, 1, 2, 5} {
+		adapter, err := bunadapter.NewAdapter(suite.db, bunadapter.WithPageSize(n))
+		suite.Require().NoError(err)
+		suite.enforcer.SetAdapter(adapter)
+
+		err = suite.enforcer.LoadPolicy()
+		suite.Require().NoError(err)
+		suite.assertEnforcerPolicy([][]string{
+			{"alice", "data1", "read"},
+			{"bob", "data2", "write"},
+			{"data2_admin", "data2", "read"},
+			{"data2_admin", "data2", "write"},
+		})
+		suite.assertEnforcerGroupingPolicy([][]string{{"alice", "data2_admin"}})
+
+		err = suite.enforcer.LoadFilteredPolicy(&bunadapter.Filter{P: []string{"", "data2"}, G: []string{}})
+		suite.Require().NoError(err)
+		suite.assertEnforcerPolicy([][]string{
+			{"bob", "data2", "write"},
+			{"data2_admin", "data2", "read"},
+			{"data2_admin", "data2", "write"},
+		})
+		suite.assertEnforcerGroupingPolicy([][]string{{"alice", "data2_admin"}})
+	}
+}
+
+// recordingLogger records the log records as "level msg key=value ...".
+type recordingLogger struct {
+	records []string
+}
+
+func (l *recordingLogger) record(level, msg string, args ...interface{}) {
+	parts := []string{level, msg}
+	for i := 0; i+1 < len(args); i += 2 {
+		if args[i] == "duration" {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%v=%v", args[i], args[i+1]))
+	}
+	l.records = append(l.records, strings.Join(parts, " "))
+}
+
+func (l *recordingLogger) Debug(msg string, args ...interface{}) { l.record("DEBUG", msg, args...) }
+func (l *recordingLogger) Info(msg string, args ...interface{})  { l.record("INFO", msg, args...) }
+func (l *recordingLogger) Warn(msg string, args ...interface{})  { l.record("WARN", msg, args...) }
+func (l *recordingLogger) Error(msg string, args ...interface{}) { l.record("ERROR", msg, args...) }
+
+func (suite *AdapterTestSuite) TestOperationLog() {
+	logger := &recordingLogger{}
+	adapter, err := bunadapter.NewAdapter(suite.db,
+		bunadapter.WithLogger(logger),
+		bunadapter.WithOperationLog(bunadapter.LevelInfo, bunadapter.LevelWarn),
+	)
+	suite.Require().NoError(err)
+
+	err = adapter.AddPolicies("p", "p", [][]string{{"carol", "data3", "read"}, {"carol", "data3", "write"}})
+	suite.Require().NoError(err)
+	m, err := model.NewModelFromFile("examples/rbac_model.conf")
+	suite.Require().NoError(err)
+	err = adapter.LoadPolicy(m)
+	suite.Require().NoError(err)
+	err = adapter.UpdatePolicies("p", "p", [][]string{{"carol", "data3", "read"}}, [][]string{{"carol", "data3", "delete"}})
+	suite.Require().NoError(err)
+	err = adapter.UpdatePolicy("p", "p", []string{"dave", "data3", "read"}, []string{"dave", "data3", "write"})
+	suite.Require().Error(err)
+
+	var records []string
+	for _, r := range logger.records {
+		if strings.Contains(r, "adapter operation") {
+			records = append(records, r)
+		}
+	}
+	suite.Require().Len(records, 4)
+	suite.Equal("INFO adapter operation operation=AddPolicies ptype=p rules=2", records[0])
+	suite.Equal("INFO adapter operation operation=LoadPolicy rules=7", records[1])
+	suite.Equal("INFO adapter operation operation=UpdatePolicies ptype=p rules=1 matched=[1]", records[2])
+	suite.True(strings.HasPrefix(records[3],
+		"WARN adapter operation failed operation=UpdatePolicy ptype=p rules=1 matched=[0] error=failed to update policies"),
+		records[3])
+}
+
+func (suite *AdapterTestSuite) TestMetrics() {
+	reg := prometheus.NewRegistry()
+	adapter, err := bunadapter.NewAdapter(suite.db, bunadapter.WithMetrics(reg))
+	suite.Require().NoError(err)
+	// Adapters share the collectors of a registerer.
+	_, err = bunadapter.NewAdapter(suite.db, bunadapter.WithMetrics(reg))
+	suite.Require().NoError(err)
+
+	// One of the rules is stored already.
+	err = adapter.AddPolicies("p", "p", [][]string{{"carol", "data3", "read"}, {"alice", "data1", "read"}})
+	suite.Require().NoError(err)
+	m, err := model.NewModelFromFile("examples/rbac_model.conf")
+	suite.Require().NoError(err)
+	err = adapter.LoadPolicy(m)
+	suite.Require().NoError(err)
+	err = adapter.RemovePolicy("p", "p", []string{"a", "b", "c", "d", "e", "f", "g"})
+	suite.Require().Error(err)
+
+	expected := `
+# HELP casbin_adapter_operations_total Policy operations by result.
+# TYPE casbin_adapter_operations_total counter
+casbin_adapter_operations_total{operation="AddPolicies",result="success",table="casbin.casbin_rules"} 1
+casbin_adapter_operations_total{operation="LoadPolicy",result="success",table="casbin.casbin_rules"} 1
+casbin_adapter_operations_total{operation="RemovePolicy",result="error",table="casbin.casbin_rules"} 1
+# HELP casbin_adapter_rows_affected_total Policy rows written or deleted.
+# TYPE casbin_adapter_rows_affected_total counter
+casbin_adapter_rows_affected_total{operation="AddPolicies",table="casbin.casbin_rules"} 1
+casbin_adapter_rows_affected_total{operation="LoadPolicy",table="casbin.casbin_rules"} 0
+casbin_adapter_rows_affected_total{operation="RemovePolicy",table="casbin.casbin_rules"} 0
+# HELP casbin_adapter_rules_total Policy rules loaded by load operations or passed to write operations.
+# TYPE casbin_adapter_rules_total counter
+casbin_adapter_rules_total{operation="AddPolicies",table="casbin.casbin_rules"} 2
+casbin_adapter_rules_total{operation="LoadPolicy",table="casbin.casbin_rules"} 6
+casbin_adapter_rules_total{operation="RemovePolicy",table="casbin.casbin_rules"} 0
+`
+	err = testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"casbin_adapter_operations_total", "casbin_adapter_rows_affected_total", "casbin_adapter_rules_total")
+	suite.NoError(err)
+
+	count, err := testutil.GatherAndCount(reg, "casbin_adapter_operation_duration_seconds")
+	suite.Require().NoError(err)
+	suite.Equal(3, count)
+}
+
+func (suite *AdapterTestSuite) TestTracing() {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	adapter, err := bunadapter.NewAdapter(suite.db, bunadapter.WithTracing(provider))
+	suite.Require().NoError(err)
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+	err = adapter.AddPoliciesCtx(ctx, "p", "p", [][]string{{"carol", "data3", "read"}, {"carol", "data3", "write"}})
+	suite.Require().NoError(err)
+	m, err := model.NewModelFromFile("examples/rbac_model.conf")
+	suite.Require().NoError(err)
+	err = adapter.LoadFilteredPolicyCtx(ctx, m, &bunadapter.QueryFilter{
+		P: []bunadapter.Matcher{bunadapter.In("carol"), bunadapter.Any(), bunadapter.Not(bunadapter.Prefix("w"))},
+		G: []bunadapter.Matcher{bunadapter.Eq("carol")},
+	})
+	suite.Require().NoError(err)
+	err = adapter.RemovePolicyCtx(ctx, "p", "p", []string{"a", "b", "c", "d", "e", "f", "g"})
+	suite.Require().Error(err)
+	err = adapter.UpdatePoliciesCtx(ctx, "p", "p", [][]string{{"carol", "data3", "read"}}, [][]string{{"carol", "data3", "delete"}})
+	suite.Require().NoError(err)
+	_, err = adapter.LastChange(ctx)
+	suite.Require().NoError(err)
+	parent.End()
+
+	spans := recorder.Ended()
+	suite.Require().Len(spans, 6)
+	for _, span := range spans[:5] {
+		suite.Equal(parent.SpanContext().SpanID(), span.Parent().SpanID(), span.Name())
+	}
+
+	suite.Equal("casbin.AddPolicies", spans[0].Name())
+	suite.ElementsMatch([]attribute.KeyValue{
+		attribute.String("db.sql.table", "casbin.casbin_rules"),
+		attribute.String("casbin.ptype", "p"),
+		attribute.Int("casbin.rules", 2),
+		attribute.Int64("casbin.rows_affected", 2),
+	}, spans[0].Attributes())
+
+	suite.Equal("casbin.LoadFilteredPolicy", spans[1].Name())
+	suite.ElementsMatch([]attribute.KeyValue{
+		attribute.String("db.sql.table", "casbin.casbin_rules"),
+		attribute.Int("casbin.rules", 1),
+		attribute.Int64("casbin.rows_affected", 0),
+		attribute.Bool("casbin.filtered", true),
+		attribute.String("casbin.filter", "g(in) p(in,any,not prefix)"),
+	}, spans[1].Attributes())
+
+	suite.Equal("casbin.RemovePolicy", spans[2].Name())
+	suite.Equal(codes.Error, spans[2].Status().Code)
+	suite.Len(spans[2].Events(), 1)
+
+	suite.Equal("casbin.UpdatePolicies", spans[3].Name())
+	suite.ElementsMatch([]attribute.KeyValue{
+		attribute.String("db.sql.table", "casbin.casbin_rules"),
+		attribute.String("casbin.ptype", "p"),
+		attribute.Int("casbin.rules", 1),
+		attribute.Int64("casbin.rows_affected", 2),
+		attribute.IntSlice("casbin.rows_matched", []int{1}),
+	}, spans[3].Attributes())
+
+	suite.Equal("casbin.LastChange", spans[4].Name())
+	suite.ElementsMatch([]attribute.KeyValue{
+		attribute.String("db.sql.table", "casbin.casbin_rules"),
+		attribute.Int("casbin.rules", 0),
+		attribute.Int64("casbin.rows_affected", 0),
+	}, spans[4].Attributes())
+}
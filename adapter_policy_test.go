@@ -166,14 +166,16 @@ func (suite *AdapterTestSuite) TestLoadFilteredPolicyNilFilter() {
 
 func (suite *AdapterTestSuite) TestSavePolicyClearPreviousData() {
 	suite.enforcer.EnableAutoSave(false)
-	policies := suite.enforcer.GetPolicy()
+	policies, err := suite.enforcer.GetPolicy()
+	suite.Require().NoError(err)
 	// clone slice to avoid shuffling elements
 	policies = append(policies[:0:0], policies...)
 	for _, p := range policies {
 		_, err := suite.enforcer.RemovePolicy(p)
 		suite.Require().NoError(err)
 	}
-	policies = suite.enforcer.GetGroupingPolicy()
+	policies, err = suite.enforcer.GetGroupingPolicy()
+	suite.Require().NoError(err)
 	policies = append(policies[:0:0], policies...)
 	for _, p := range policies {
 		_, err := suite.enforcer.RemoveGroupingPolicy(p)
@@ -181,7 +183,7 @@ func (suite *AdapterTestSuite) TestSavePolicyClearPreviousData() {
 	}
 	suite.assertEnforcerPolicy([][]string{})
 
-	err := suite.enforcer.SavePolicy()
+	err = suite.enforcer.SavePolicy()
 	suite.Require().NoError(err)
 
 	err = suite.enforcer.LoadPolicy()
@@ -226,7 +228,10 @@ func (suite *AdapterTestSuite) TestUpdatePolicyWithLoadFilteredPolicy() {
 	err = suite.enforcer.LoadFilteredPolicy(&bunadapter.Filter{P: []string{"data2_admin"}})
 	suite.Require().NoError(err)
 
-	_, err = suite.enforcer.UpdatePolicies(suite.enforcer.GetPolicy(), [][]string{{"bob", "data2", "read"}, {"alice", "data2", "write"}})
+	policies, err := suite.enforcer.GetPolicy()
+	suite.Require().NoError(err)
+
+	_, err = suite.enforcer.UpdatePolicies(policies, [][]string{{"bob", "data2", "read"}, {"alice", "data2", "write"}})
 	suite.Require().NoError(err)
 
 	err = suite.enforcer.LoadPolicy()
@@ -240,6 +245,53 @@ func (suite *AdapterTestSuite) TestUpdatePolicyWithLoadFilteredPolicy() {
 	})
 }
 
+func (suite *AdapterTestSuite) TestUpdatePolicyRecomputesID() {
+	err := suite.adapter.UpdatePolicy("p", "p", []string{"alice", "data1", "read"}, []string{"alice", "data1", "write"})
+	suite.Require().NoError(err)
+
+	// The rule is removed by the ID of its new values.
+	err = suite.adapter.RemovePolicy("p", "p", []string{"alice", "data1", "write"})
+	suite.Require().NoError(err)
+	err = suite.adapter.AddPolicy("p", "p", []string{"alice", "data1", "read"})
+	suite.Require().NoError(err)
+
+	err = suite.enforcer.LoadPolicy()
+	suite.Require().NoError(err)
+	suite.assertEnforcerPolicy([][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"},
+	})
+}
+
+func (suite *AdapterTestSuite) TestUpdatePolicyErrors() {
+	err := suite.adapter.UpdatePolicy("p", "p", []string{"carol", "data3", "read"}, []string{"carol", "data3", "write"})
+	suite.ErrorIs(err, bunadapter.ErrRuleNotFound)
+
+	// Old rules match exactly, not by prefix.
+	err = suite.adapter.UpdatePolicy("p", "p", []string{"alice", "data1"}, []string{"alice", "data2"})
+	suite.ErrorIs(err, bunadapter.ErrRuleNotFound)
+
+	err = suite.adapter.UpdatePolicy("p", "p", []string{"alice", "data1", "read"}, []string{"bob", "data2", "write"})
+	suite.ErrorIs(err, bunadapter.ErrRuleExists)
+
+	// A failed rule rolls back the whole update.
+	err = suite.adapter.UpdatePolicies("p", "p",
+		[][]string{{"alice", "data1", "read"}, {"carol", "data3", "read"}},
+		[][]string{{"alice", "data1", "write"}, {"carol", "data3", "write"}})
+	suite.ErrorIs(err, bunadapter.ErrRuleNotFound)
+
+	err = suite.enforcer.LoadPolicy()
+	suite.Require().NoError(err)
+	suite.assertEnforcerPolicy([][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"},
+	})
+}
+
 func (suite *AdapterTestSuite) TestUpdateFilteredPolicies() {
 
 	var err error
@@ -266,3 +318,27 @@ func (suite *AdapterTestSuite) TestUpdateFilteredPolicies() {
 		{"bob", "data1", "read"},
 	})
 }
+
+func (suite *AdapterTestSuite) TestUpdateFilteredPoliciesWithEnforcer() {
+	removed, err := suite.enforcer.UpdateFilteredPolicies(
+		[][]string{{"data3_admin", "data3", "read"}, {"data3_admin", "data3", "write"}}, 0, "data2_admin")
+	suite.Require().NoError(err)
+	suite.True(removed)
+
+	// The enforcer removes the returned rules from its model.
+	suite.assertEnforcerPolicy([][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data3_admin", "data3", "read"},
+		{"data3_admin", "data3", "write"},
+	})
+
+	err = suite.enforcer.LoadPolicy()
+	suite.Require().NoError(err)
+	suite.assertEnforcerPolicy([][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data3_admin", "data3", "read"},
+		{"data3_admin", "data3", "write"},
+	})
+}
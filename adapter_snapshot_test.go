@@ -0,0 +1,70 @@
+package bunadapter_test
+
+import (
+	"context"
+
+	"github.com/casbin/casbin/v2/model"
+
+	bunadapter "github.com/msales/casbin-bun-adapter"
+)
+
+func (suite *AdapterTestSuite) TestSnapshot() {
+	ctx := context.Background()
+
+	snapshot, err := suite.adapter.Snapshot(ctx, "before deploy")
+	suite.Require().NoError(err)
+	suite.Equal("before deploy", snapshot.Label)
+	suite.Equal(5, snapshot.RuleCount)
+
+	// A broken model replaces the policy.
+	suite.enforcer.ClearPolicy()
+	_, err = suite.enforcer.AddPolicy("carol", "data3", "read")
+	suite.Require().NoError(err)
+	err = suite.enforcer.SavePolicy()
+	suite.Require().NoError(err)
+
+	snapshots, err := suite.adapter.ListSnapshots(ctx)
+	suite.Require().NoError(err)
+	suite.Require().NotEmpty(snapshots)
+	last := snapshots[len(snapshots)-1]
+	suite.Equal(snapshot.ID, last.ID)
+	suite.Equal(5, last.RuleCount)
+	suite.False(last.CreatedAt.IsZero())
+
+	m, err := model.NewModelFromFile("examples/rbac_model.conf")
+	suite.Require().NoError(err)
+	err = suite.adapter.LoadSnapshot(ctx, m, snapshot.ID)
+	suite.Require().NoError(err)
+	policies, err := m.GetPolicy("p", "p")
+	suite.Require().NoError(err)
+	suite.Len(policies, 4)
+
+	err = suite.adapter.RestoreSnapshot(ctx, snapshot.ID)
+	suite.Require().NoError(err)
+	err = suite.enforcer.LoadPolicy()
+	suite.Require().NoError(err)
+	suite.assertEnforcerPolicy([][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"},
+	})
+	suite.assertEnforcerGroupingPolicy([][]string{{"alice", "data2_admin"}})
+}
+
+func (suite *AdapterTestSuite) TestSnapshotNotFound() {
+	ctx := context.Background()
+
+	err := suite.adapter.RestoreSnapshot(ctx, -1)
+	suite.ErrorIs(err, bunadapter.ErrSnapshotNotFound)
+
+	m, err := model.NewModelFromFile("examples/rbac_model.conf")
+	suite.Require().NoError(err)
+	err = suite.adapter.LoadSnapshot(ctx, m, -1)
+	suite.ErrorIs(err, bunadapter.ErrSnapshotNotFound)
+
+	// The policy is left untouched.
+	err = suite.enforcer.LoadPolicy()
+	suite.Require().NoError(err)
+	suite.assertEnforcerGroupingPolicy([][]string{{"alice", "data2_admin"}})
+}
@@ -0,0 +1,62 @@
+package bunadapter_test
+
+import (
+	"context"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+)
+
+func (suite *AdapterTestSuite) TestWithTx() {
+	ctx := context.Background()
+
+	tx, err := suite.db.BeginTx(ctx, nil)
+	suite.Require().NoError(err)
+	view := suite.adapter.WithTx(tx)
+
+	err = view.AddPolicy("p", "p", []string{"carol", "data3", "read"})
+	suite.Require().NoError(err)
+	err = view.RemovePolicy("p", "p", []string{"bob", "data2", "write"})
+	suite.Require().NoError(err)
+
+	// The view sees its own uncommitted changes.
+	m, err := model.NewModelFromFile("examples/rbac_model.conf")
+	suite.Require().NoError(err)
+	err = view.LoadPolicy(m)
+	suite.Require().NoError(err)
+	policies, err := m.GetPolicy("p", "p")
+	suite.Require().NoError(err)
+	suite.Contains(policies, []string{"carol", "data3", "read"})
+	suite.NotContains(policies, []string{"bob", "data2", "write"})
+
+	err = tx.Rollback()
+	suite.Require().NoError(err)
+
+	err = suite.enforcer.LoadPolicy()
+	suite.Require().NoError(err)
+	suite.assertEnforcerPolicy([][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"},
+	})
+
+	tx, err = suite.db.BeginTx(ctx, nil)
+	suite.Require().NoError(err)
+	enforcer, err := casbin.NewEnforcer("examples/rbac_model.conf", suite.adapter.WithTx(tx))
+	suite.Require().NoError(err)
+	_, err = enforcer.AddPolicy("carol", "data3", "read")
+	suite.Require().NoError(err)
+	err = tx.Commit()
+	suite.Require().NoError(err)
+
+	err = suite.enforcer.LoadPolicy()
+	suite.Require().NoError(err)
+	suite.assertEnforcerPolicy([][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"},
+		{"carol", "data3", "read"},
+	})
+}
@@ -0,0 +1,202 @@
+package bunadapter_test
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/uptrace/bun/dialect"
+
+	bunadapter "github.com/msales/casbin-bun-adapter"
+)
+
+func (suite *AdapterTestSuite) TestWatcher() {
+	if suite.db.Dialect().Name() != dialect.PG {
+		suite.T().Skip("watcher requires Postgres")
+	}
+
+	ctx := context.Background()
+
+	w1, err := bunadapter.NewWatcher(ctx, suite.db, bunadapter.WithChannel("casbin_test"))
+	suite.Require().NoError(err)
+	defer w1.Close()
+	w2, err := bunadapter.NewWatcher(ctx, suite.db, bunadapter.WithChannel("casbin_test"))
+	suite.Require().NoError(err)
+	defer w2.Close()
+
+	err = suite.enforcer.SetWatcher(w1)
+	suite.Require().NoError(err)
+	err = w1.SetUpdateCallback(func(string) {
+		suite.Fail("watcher received its own notification")
+	})
+	suite.Require().NoError(err)
+
+	// The adapter of the notified enforcer logs every operation it runs.
+	logger := &recordingLogger{}
+	adapter, err := bunadapter.NewAdapter(suite.db,
+		bunadapter.WithLogger(logger),
+		bunadapter.WithOperationLog(bunadapter.LevelInfo, bunadapter.LevelWarn),
+	)
+	suite.Require().NoError(err)
+	enforcer, err := casbin.NewEnforcer("examples/rbac_model.conf", adapter)
+	suite.Require().NoError(err)
+	logger.records = nil
+
+	received := make(chan string, 1)
+	callback := bunadapter.DefaultUpdateCallback(enforcer, nil)
+	err = w2.SetUpdateCallback(func(payload string) {
+		callback(payload)
+		received <- payload
+	})
+	suite.Require().NoError(err)
+
+	_, err = suite.enforcer.AddPolicy("carol", "data3", "read")
+	suite.Require().NoError(err)
+
+	select {
+	case payload := <-received:
+		var msg bunadapter.WatcherMessage
+		err = json.Unmarshal([]byte(payload), &msg)
+		suite.Require().NoError(err)
+		suite.Equal(bunadapter.UpdateForAddPolicy, msg.Method)
+	case <-time.After(5 * time.Second):
+		suite.FailNow("notification not received")
+	}
+
+	ok, err := enforcer.HasPolicy("carol", "data3", "read")
+	suite.Require().NoError(err)
+	suite.True(ok)
+	suite.Empty(logger.records, "the notification was written back to the database")
+}
+
+func (suite *AdapterTestSuite) TestWatcherRequiresPostgres() {
+	if suite.db.Dialect().Name() == dialect.PG {
+		suite.T().Skip("watcher supports Postgres")
+	}
+
+	_, err := bunadapter.NewWatcher(context.Background(), suite.db)
+	suite.Error(err)
+}
+
+func (suite *AdapterTestSuite) TestDefaultUpdateCallback() {
+	enforcer, err := casbin.NewDistributedEnforcer("examples/rbac_model.conf", suite.adapter)
+	suite.Require().NoError(err)
+	suite.enforcer = enforcer.SyncedEnforcer.Enforcer
+
+	callback := bunadapter.DefaultUpdateCallback(enforcer, nil)
+	send := func(msg bunadapter.WatcherMessage) {
+		payload, err := json.Marshal(msg)
+		suite.Require().NoError(err)
+		callback(string(payload))
+	}
+
+	send(bunadapter.WatcherMessage{
+		Method: bunadapter.UpdateForAddPolicies,
+		Sec:    "p",
+		Ptype:  "p",
+		Rules:  [][]string{{"carol", "data3", "read"}, {"alice", "data1", "read"}},
+	})
+	send(bunadapter.WatcherMessage{
+		Method:      bunadapter.UpdateForRemoveFilteredPolicy,
+		Sec:         "p",
+		Ptype:       "p",
+		FieldIndex:  0,
+		FieldValues: []string{"data2_admin"},
+	})
+	suite.assertEnforcerPolicy([][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"carol", "data3", "read"},
+	})
+
+	// The changes are applied in memory only, a reload restores the stored policy.
+	send(bunadapter.WatcherMessage{Method: bunadapter.Update})
+	suite.assertEnforcerPolicy([][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"},
+	})
+
+	send(bunadapter.WatcherMessage{
+		Method: bunadapter.UpdateForRemovePolicy,
+		Sec:    "p",
+		Ptype:  "p",
+		Rules:  [][]string{{"bob", "data2", "write"}},
+	})
+	suite.assertEnforcerPolicy([][]string{
+		{"alice", "data1", "read"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"},
+	})
+}
+
+func (suite *AdapterTestSuite) TestDefaultUpdateCallbackModelOnly() {
+	logger := &recordingLogger{}
+	adapter, err := bunadapter.NewAdapter(suite.db,
+		bunadapter.WithLogger(logger),
+		bunadapter.WithOperationLog(bunadapter.LevelInfo, bunadapter.LevelWarn),
+	)
+	suite.Require().NoError(err)
+
+	plain, err := casbin.NewEnforcer("examples/rbac_model.conf", adapter)
+	suite.Require().NoError(err)
+	synced, err := casbin.NewSyncedEnforcer("examples/rbac_model.conf", adapter)
+	suite.Require().NoError(err)
+
+	for _, enforcer := range []casbin.IEnforcer{plain, synced} {
+		logger.records = nil
+
+		callback := bunadapter.DefaultUpdateCallback(enforcer, nil)
+		send := func(msg bunadapter.WatcherMessage) {
+			payload, err := json.Marshal(msg)
+			suite.Require().NoError(err)
+			callback(string(payload))
+		}
+
+		send(bunadapter.WatcherMessage{
+			Method: bunadapter.UpdateForAddPolicies,
+			Sec:    "g",
+			Ptype:  "g",
+			Rules:  [][]string{{"carol", "data2_admin"}},
+		})
+		send(bunadapter.WatcherMessage{
+			Method: bunadapter.UpdateForRemovePolicies,
+			Sec:    "p",
+			Ptype:  "p",
+			Rules:  [][]string{{"bob", "data2", "write"}},
+		})
+		send(bunadapter.WatcherMessage{
+			Method:      bunadapter.UpdateForRemoveFilteredPolicy,
+			Sec:         "g",
+			Ptype:       "g",
+			FieldIndex:  0,
+			FieldValues: []string{"alice"},
+		})
+
+		// Role links follow the grouping rules.
+		ok, err := enforcer.Enforce("carol", "data2", "read")
+		suite.Require().NoError(err)
+		suite.True(ok)
+		ok, err = enforcer.Enforce("alice", "data2", "read")
+		suite.Require().NoError(err)
+		suite.False(ok)
+		ok, err = enforcer.Enforce("bob", "data2", "write")
+		suite.Require().NoError(err)
+		suite.False(ok)
+
+		suite.Empty(logger.records, "%T wrote the notification back to the database", enforcer)
+	}
+
+	// The stored policy is unchanged.
+	err = suite.enforcer.LoadPolicy()
+	suite.Require().NoError(err)
+	suite.assertEnforcerPolicy([][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"},
+	})
+	suite.assertEnforcerGroupingPolicy([][]string{{"alice", "data2_admin"}})
+}
@@ -0,0 +1,174 @@
+package bunadapter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// AuditOp is the adapter operation recorded by an AuditEntry.
+type AuditOp string
+
+// Audited operations.
+const (
+	AuditAdd            AuditOp = "add"
+	AuditRemove         AuditOp = "remove"
+	AuditRemoveFiltered AuditOp = "remove_filtered"
+	AuditUpdate         AuditOp = "update"
+	AuditUpdateFiltered AuditOp = "update_filtered"
+	AuditSave           AuditOp = "save"
+)
+
+// AuditEntry is a row of the audit history, see WithAudit.
+// Subject and object are the first two values of a rule, OldRule is empty for added rules
+// and NewRule for removed ones.
+type AuditEntry struct {
+	ID         int64 `bun:",pk,autoincrement"`
+	Op         AuditOp
+	Ptype      string
+	OldRule    []string
+	NewRule    []string
+	OldSubject string
+	OldObject  string
+	NewSubject string
+	NewObject  string
+	Actor      string
+	CreatedAt  time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+// AuditQuery selects audit history entries, empty fields match any entry.
+type AuditQuery struct {
+	// Subject matches entries whose old or new rule has the subject.
+	Subject string
+	// Object matches entries whose old or new rule has the object.
+	Object string
+	Ptype  string
+	Since  time.Time
+	// Limit caps the number of returned entries, zero returns all.
+	Limit int
+}
+
+type actorKey struct{}
+
+// ContextWithActor returns a context recording actor as the author of the policy changes made with it.
+// Use it with the Ctx methods of the adapter.
+func ContextWithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set by ContextWithActor.
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+
+	return actor
+}
+
+// AuditHistory returns the audit history entries matching the query, oldest first.
+func (a *Adapter) AuditHistory(ctx context.Context, q AuditQuery) (_ []*AuditEntry, err error) {
+	ctx, op := a.startOp(ctx, "AuditHistory", q.Ptype)
+	defer a.endOp(op, &err)
+
+	var entries []*AuditEntry
+
+	query := a.idb().NewSelect().
+		Model(&entries).
+		ModelTableExpr("? AS ?", a.auditTable(), bun.Ident("audit_entry")).
+		Order("id")
+	if q.Subject != "" {
+		query = query.Where("(old_subject = ? OR new_subject = ?)", q.Subject, q.Subject)
+	}
+	if q.Object != "" {
+		query = query.Where("(old_object = ? OR new_object = ?)", q.Object, q.Object)
+	}
+	if q.Ptype != "" {
+		query = query.Where("ptype = ?", q.Ptype)
+	}
+	if !q.Since.IsZero() {
+		query = query.Where("created_at >= ?", q.Since)
+	}
+	if q.Limit > 0 {
+		query = query.Limit(q.Limit)
+	}
+
+	if err := query.Scan(ctx); err != nil {
+		return nil, fmt.Errorf("failed to load audit history: %w", err)
+	}
+
+	return entries, nil
+}
+
+// auditRules records an audit entry per rule when enabled, added rules are audited with their new values
+// and removed ones with their old values.
+func (a *Adapter) auditRules(ctx context.Context, db bun.IDB, op AuditOp, removed, added []*CasbinRule) error {
+	if !a.audit {
+		return nil
+	}
+
+	entries := make([]*AuditEntry, 0, len(removed)+len(added))
+	for _, line := range removed {
+		entries = append(entries, newAuditEntry(op, line, nil))
+	}
+	for _, line := range added {
+		entries = append(entries, newAuditEntry(op, nil, line))
+	}
+
+	return a.insertAudit(ctx, db, entries)
+}
+
+// auditUpdates records an audit entry per updated rule when enabled.
+func (a *Adapter) auditUpdates(ctx context.Context, db bun.IDB, oldLines, newLines []*CasbinRule) error {
+	if !a.audit {
+		return nil
+	}
+
+	entries := make([]*AuditEntry, 0, len(oldLines))
+	for i := range oldLines {
+		entries = append(entries, newAuditEntry(AuditUpdate, oldLines[i], newLines[i]))
+	}
+
+	return a.insertAudit(ctx, db, entries)
+}
+
+func (a *Adapter) insertAudit(ctx context.Context, db bun.IDB, entries []*AuditEntry) error {
+	actor := ActorFromContext(ctx)
+	for _, e := range entries {
+		e.Actor = actor
+	}
+
+	for start := 0; start < len(entries); start += a.batchSize {
+		end := start + a.batchSize
+		if end > len(entries) {
+			end = len(entries)
+		}
+
+		batch := entries[start:end]
+		_, err := db.NewInsert().Model(&batch).ModelTableExpr("?", a.auditTable()).Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to write audit history: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func newAuditEntry(op AuditOp, oldLine, newLine *CasbinRule) *AuditEntry {
+	e := &AuditEntry{Op: op}
+	if oldLine != nil {
+		e.Ptype = oldLine.Ptype
+		e.OldRule = oldLine.values()
+		e.OldSubject, e.OldObject = oldLine.V0, oldLine.V1
+	}
+	if newLine != nil {
+		e.Ptype = newLine.Ptype
+		e.NewRule = newLine.values()
+		e.NewSubject, e.NewObject = newLine.V0, newLine.V1
+	}
+
+	return e
+}
+
+func (a *Adapter) auditTable() bun.Ident {
+	return a.qualify(a.tableName + "_audit")
+}
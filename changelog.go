@@ -0,0 +1,202 @@
+package bunadapter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	"github.com/uptrace/bun"
+)
+
+// ChangeOp is the kind of a logged policy change.
+type ChangeOp string
+
+// Policy change kinds.
+const (
+	// ChangeAdd records an added rule.
+	ChangeAdd ChangeOp = "add"
+	// ChangeRemove records a removed rule.
+	ChangeRemove ChangeOp = "remove"
+)
+
+// Change is an entry of the change log, see WithChangeLog.
+type Change struct {
+	Seq       int64 `bun:",pk,autoincrement"`
+	Op        ChangeOp
+	Ptype     string
+	Rule      []string
+	CreatedAt time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+// Changes returns the logged changes with a sequence number greater than since, oldest first.
+func (a *Adapter) Changes(ctx context.Context, since int64) (_ []*Change, err error) {
+	ctx, op := a.startOp(ctx, "Changes", "")
+	defer a.endOp(op, &err)
+
+	changes, err := a.changes(ctx, since)
+	op.rules = len(changes)
+
+	return changes, err
+}
+
+func (a *Adapter) changes(ctx context.Context, since int64) ([]*Change, error) {
+	var changes []*Change
+
+	err := a.idb().NewSelect().
+		Model(&changes).
+		ModelTableExpr("? AS ?", a.changesTable(), bun.Ident("change")).
+		Where("seq > ?", since).
+		Order("seq").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load policy changes: %w", err)
+	}
+
+	return changes, nil
+}
+
+// LastChange returns the sequence number of the latest logged change, 0 if there is none.
+// Pruned changes count, so it never goes back.
+// Read it before LoadPolicy to follow the changes made after the policy was loaded.
+func (a *Adapter) LastChange(ctx context.Context) (_ int64, err error) {
+	ctx, op := a.startOp(ctx, "LastChange", "")
+	defer a.endOp(op, &err)
+
+	var seq int64
+
+	err = a.idb().NewSelect().
+		ModelTableExpr("?", a.changesLockTable()).
+		Column("version").
+		Where("id = 1").
+		Scan(ctx, &seq)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load last policy change: %w", err)
+	}
+
+	return seq, nil
+}
+
+// LoadChanges applies the changes logged after since to the model and returns the sequence number
+// to continue from.
+// Changes are applied to policies only, rebuild the role links of the enforcer afterwards.
+func (a *Adapter) LoadChanges(ctx context.Context, model model.Model, since int64) (_ int64, err error) {
+	ctx, op := a.startOp(ctx, "LoadChanges", "")
+	defer a.endOp(op, &err)
+
+	changes, err := a.changes(ctx, since)
+	if err != nil {
+		return since, err
+	}
+	op.rules = len(changes)
+	if len(changes) == 0 {
+		return since, nil
+	}
+	for _, c := range changes {
+		if err := applyChange(model, c); err != nil {
+			return since, fmt.Errorf("failed to apply policy change %d: %w", c.Seq, err)
+		}
+	}
+
+	return changes[len(changes)-1].Seq, nil
+}
+
+// PruneChanges deletes the logged changes with a sequence number up to seq.
+func (a *Adapter) PruneChanges(ctx context.Context, seq int64) (err error) {
+	ctx, op := a.startOp(ctx, "PruneChanges", "")
+	defer a.endOp(op, &err)
+
+	res, err := a.idb().NewDelete().
+		Model((*Change)(nil)).
+		ModelTableExpr("?", a.changesTable()).
+		Where("seq <= ?", seq).
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to prune policy changes: %w", err)
+	}
+	addAffected(ctx, res)
+
+	return nil
+}
+
+func applyChange(model model.Model, c *Change) error {
+	if c.Ptype == "" {
+		return fmt.Errorf("change without ptype")
+	}
+
+	switch c.Op {
+	case ChangeAdd:
+		return persist.LoadPolicyArray(append([]string{c.Ptype}, c.Rule...), model)
+	case ChangeRemove:
+		_, err := model.RemovePolicy(c.Ptype[:1], c.Ptype, c.Rule)
+
+		return err
+	default:
+		return fmt.Errorf("unknown change op %q", c.Op)
+	}
+}
+
+// logChanges records the removed and added rules in the change log when enabled, db is the transaction of the change.
+// Call it last in the transaction, it locks the change log until the transaction ends.
+func (a *Adapter) logChanges(ctx context.Context, db bun.IDB, removed, added []*CasbinRule) error {
+	if !a.changeLog || len(removed)+len(added) == 0 {
+		return nil
+	}
+
+	changes := make([]*Change, 0, len(removed)+len(added))
+	for _, line := range removed {
+		changes = append(changes, &Change{Op: ChangeRemove, Ptype: line.Ptype, Rule: line.values()})
+	}
+	for _, line := range added {
+		changes = append(changes, &Change{Op: ChangeAdd, Ptype: line.Ptype, Rule: line.values()})
+	}
+
+	last, err := a.reserveSeqs(ctx, db, len(changes))
+	if err != nil {
+		return fmt.Errorf("failed to lock policy changes: %w", err)
+	}
+	for i, c := range changes {
+		c.Seq = last - int64(len(changes)-1-i)
+	}
+
+	for start := 0; start < len(changes); start += a.batchSize {
+		end := start + a.batchSize
+		if end > len(changes) {
+			end = len(changes)
+		}
+
+		batch := changes[start:end]
+		_, err := db.NewInsert().Model(&batch).ModelTableExpr("?", a.changesTable()).Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to log policy changes: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// reserveSeqs advances the version of the change log lock row by n and returns the last of the n sequence numbers
+// it reserved. The version never goes back, so sequence numbers are not reused after PruneChanges.
+// The row stays locked until the transaction of db ends. Writers are serialized,
+// so changes commit in the order of their sequence numbers and a reader past a change never misses an earlier one.
+func (a *Adapter) reserveSeqs(ctx context.Context, db bun.IDB, n int) (int64, error) {
+	var version int64
+
+	_, err := db.NewUpdate().
+		TableExpr("?", a.changesLockTable()).
+		Set("version = version + ?", n).
+		Where("id = 1").
+		Returning("version").
+		Exec(ctx, &version)
+
+	return version, err
+}
+
+func (a *Adapter) changesLockTable() bun.Ident {
+	return a.qualify(a.tableName + "_changes_lock")
+}
+
+func (a *Adapter) changesTable() bun.Ident {
+	return a.qualify(a.tableName + "_changes")
+}
@@ -0,0 +1,98 @@
+package bunadapter
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"strconv"
+	"strings"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+// copyEscaper escapes values for the text format of COPY.
+var copyEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+// runInConnTx runs fn in a transaction on a dedicated connection, COPY needs the connection itself.
+func (a *Adapter) runInConnTx(ctx context.Context, fn func(ctx context.Context, conn bun.Conn) error) error {
+	conn, err := a.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "BEGIN"); err != nil {
+		return err
+	}
+
+	if err := fn(ctx, conn); err != nil {
+		if _, rbErr := conn.ExecContext(context.Background(), "ROLLBACK"); rbErr != nil {
+			a.logger.Error("failed to rollback transaction", "error", rbErr)
+		}
+
+		return err
+	}
+
+	_, err = conn.ExecContext(ctx, "COMMIT")
+
+	return err
+}
+
+// copyRules copies the rules into a temporary table and inserts them from there skipping existing ones,
+// COPY itself cannot skip conflicting rows. It returns the inserted rules.
+func (a *Adapter) copyRules(ctx context.Context, conn bun.Conn, lines ...*CasbinRule) ([]*CasbinRule, error) {
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	tmp := bun.Ident(a.tableName + "_copy")
+	columns := a.columnIdents()
+
+	_, err := conn.ExecContext(ctx, "CREATE TEMP TABLE ? (LIKE ? INCLUDING DEFAULTS) ON COMMIT DROP", tmp, a.table())
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(copyEscaper.Replace(line.ID))
+		buf.WriteByte('\t')
+		buf.WriteString(copyEscaper.Replace(line.Ptype))
+		fields := line.fields()
+		for _, v := range fields[:a.columnCount] {
+			buf.WriteByte('\t')
+			buf.WriteString(copyEscaper.Replace(*v))
+		}
+		buf.WriteByte('\t')
+		buf.WriteString(strconv.Itoa(line.FieldCount))
+		buf.WriteByte('\n')
+	}
+
+	query := a.db.Formatter().FormatQuery("COPY ? (?) FROM STDIN", tmp, bun.In(columns))
+	if _, err := pgdriver.CopyFrom(ctx, conn, &buf, query); err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.QueryContext(ctx, "INSERT INTO ? (?) SELECT ? FROM ? ON CONFLICT DO NOTHING RETURNING id",
+		a.table(), bun.In(columns), bun.In(columns), tmp)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	addAffected(ctx, driver.RowsAffected(len(ids)))
+
+	return rulesWithIDs(lines, ids), nil
+}
@@ -0,0 +1,90 @@
+package bunadapter
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+)
+
+// Postgres and SQLite share the SQL of the adapter, both skip conflicts with ON CONFLICT DO NOTHING
+// and return the written rows with RETURNING. bun's MySQL and MSSQL dialects support neither.
+
+// checkDialect returns an error when the dialect of db is not supported by the adapter.
+func checkDialect(db bun.IDB) error {
+	switch name := db.Dialect().Name(); name {
+	case dialect.PG, dialect.SQLite:
+		return nil
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedDialect, name)
+	}
+}
+
+// insertReturning inserts the rules skipping existing ones and returns the inserted rules.
+func (a *Adapter) insertReturning(ctx context.Context, db bun.IDB, lines []*CasbinRule) ([]*CasbinRule, error) {
+	var ids []string
+
+	res, err := a.newInsert(db, &lines).Ignore().Returning("id").Exec(ctx, &ids)
+	if err != nil {
+		return nil, err
+	}
+	addAffected(ctx, res)
+
+	return rulesWithIDs(lines, ids), nil
+}
+
+// rulesWithIDs returns the rules of lines with the ids, each ID once.
+func rulesWithIDs(lines []*CasbinRule, ids []string) []*CasbinRule {
+	want := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		want[id] = struct{}{}
+	}
+
+	rules := make([]*CasbinRule, 0, len(ids))
+	for _, line := range lines {
+		if _, ok := want[line.ID]; ok {
+			delete(want, line.ID)
+			rules = append(rules, line)
+		}
+	}
+
+	return rules
+}
+
+// deleteReturning deletes the rules matching the condition and scans them into lines.
+func (a *Adapter) deleteReturning(ctx context.Context, db bun.IDB, lines *[]*CasbinRule, query string, args ...interface{}) (sql.Result, error) {
+	return a.newDelete(db, lines).Where(query, args...).Returning("*").Exec(ctx)
+}
+
+// likeEscaper escapes LIKE wildcards with '!', which needs no quoting.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// globEscaper escapes GLOB wildcards as character classes.
+var globEscaper = strings.NewReplacer("*", "[*]", "?", "[?]", "[", "[[]")
+
+// prefixMatch returns the condition matching values of col starting with prefix, case-sensitively.
+// LIKE ignores case on SQLite, GLOB does not.
+func prefixMatch(name dialect.Name, col bun.Ident, prefix string) (string, []interface{}) {
+	if name == dialect.SQLite {
+		return "? GLOB ?", []interface{}{col, globEscaper.Replace(prefix) + "*"}
+	}
+
+	return "? LIKE ? ESCAPE '!'", []interface{}{col, likeEscaper.Replace(prefix) + "%"}
+}
+
+// runInSnapshot runs fn in a read-only transaction reading a consistent snapshot of the database.
+func runInSnapshot(ctx context.Context, db *bun.DB, fn func(ctx context.Context, tx bun.Tx) error) error {
+	return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if db.Dialect().Name() == dialect.PG {
+			// pgdriver rejects transaction options, SQLite transactions read a snapshot already.
+			if _, err := tx.ExecContext(ctx, "SET TRANSACTION ISOLATION LEVEL REPEATABLE READ, READ ONLY"); err != nil {
+				return err
+			}
+		}
+
+		return fn(ctx, tx)
+	})
+}
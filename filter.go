@@ -0,0 +1,236 @@
+package bunadapter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/uptrace/bun"
+)
+
+// Filter represents adapter filter.
+// Ptypes maps a policy type to the field values its rules must match, empty values match anything.
+// Only policy types present in the filter are loaded. P and G are shorthand for the "p" and "g" entries.
+type Filter struct {
+	P      []string
+	G      []string
+	Ptypes map[string][]string
+}
+
+// matchers merges P and G into Ptypes, explicit Ptypes entries take precedence.
+func (f *Filter) matchers() map[string][]Matcher {
+	patterns := make(map[string][]string, len(f.Ptypes)+2)
+	if f.P != nil {
+		patterns["p"] = f.P
+	}
+	if f.G != nil {
+		patterns["g"] = f.G
+	}
+	for ptype, values := range f.Ptypes {
+		patterns[ptype] = values
+	}
+
+	matchers := make(map[string][]Matcher, len(patterns))
+	for ptype, values := range patterns {
+		fields := make([]Matcher, len(values))
+		for i, v := range values {
+			if v != "" {
+				fields[i] = Eq(v)
+			}
+		}
+		matchers[ptype] = fields
+	}
+
+	return matchers
+}
+
+// QueryFilter is a filter with a matcher per field, rules must satisfy every matcher at its field position.
+// Only policy types present in the filter are loaded. P and G are shorthand for the "p" and "g" entries.
+type QueryFilter struct {
+	P      []Matcher
+	G      []Matcher
+	Ptypes map[string][]Matcher
+}
+
+// matchers merges P and G into Ptypes, explicit Ptypes entries take precedence.
+func (f *QueryFilter) matchers() map[string][]Matcher {
+	matchers := make(map[string][]Matcher, len(f.Ptypes)+2)
+	if f.P != nil {
+		matchers["p"] = f.P
+	}
+	if f.G != nil {
+		matchers["g"] = f.G
+	}
+	for ptype, fields := range f.Ptypes {
+		matchers[ptype] = fields
+	}
+
+	return matchers
+}
+
+type matchOp int
+
+const (
+	matchAny matchOp = iota
+	matchIn
+	matchPrefix
+	matchEmpty
+)
+
+func (op matchOp) String() string {
+	switch op {
+	case matchIn:
+		return "in"
+	case matchPrefix:
+		return "prefix"
+	case matchEmpty:
+		return "empty"
+	default:
+		return "any"
+	}
+}
+
+// Matcher matches a single rule field. The zero value matches anything.
+type Matcher struct {
+	op     matchOp
+	values []string
+	negate bool
+}
+
+// Any matches any field value.
+func Any() Matcher {
+	return Matcher{}
+}
+
+// Eq matches fields equal to value.
+func Eq(value string) Matcher {
+	return In(value)
+}
+
+// In matches fields equal to any of values. Without values it matches nothing.
+func In(values ...string) Matcher {
+	return Matcher{op: matchIn, values: values}
+}
+
+// Prefix matches fields starting with prefix.
+func Prefix(prefix string) Matcher {
+	return Matcher{op: matchPrefix, values: []string{prefix}}
+}
+
+// Empty matches empty fields.
+func Empty() Matcher {
+	return Matcher{op: matchEmpty}
+}
+
+// Not matches fields not matched by m.
+func Not(m Matcher) Matcher {
+	m.negate = !m.negate
+
+	return m
+}
+
+func (m Matcher) isAny() bool {
+	return m.op == matchAny && !m.negate
+}
+
+func (m Matcher) appendQuery(q *bun.SelectQuery, column string) *bun.SelectQuery {
+	col := bun.Ident(column)
+
+	var (
+		expr string
+		args []interface{}
+	)
+	switch m.op {
+	case matchIn:
+		switch len(m.values) {
+		case 0:
+			expr = "1 = 0"
+		case 1:
+			expr, args = "? = ?", []interface{}{col, m.values[0]}
+		default:
+			expr, args = "? IN (?)", []interface{}{col, bun.In(m.values)}
+		}
+	case matchPrefix:
+		expr, args = prefixMatch(q.Dialect().Name(), col, m.values[0])
+	case matchEmpty:
+		// Columns added by migrations are NULL in older rows.
+		expr, args = "COALESCE(?, '') = ''", []interface{}{col}
+	default:
+		if m.negate {
+			return q.Where("1 = 0")
+		}
+
+		return q
+	}
+
+	if !m.negate {
+		return q.Where(expr, args...)
+	}
+	if m.op == matchEmpty {
+		return q.Where("NOT ("+expr+")", args...)
+	}
+
+	return q.Where("(? IS NULL OR NOT ("+expr+"))", append([]interface{}{col}, args...)...)
+}
+
+// filterQuery restricts query to the rules matched by any of filters, maps of policy type to field matchers.
+func (a *Adapter) filterQuery(query *bun.SelectQuery, filters ...map[string][]Matcher) (*bun.SelectQuery, error) {
+	ptypes := make([][]string, len(filters))
+	for i, filter := range filters {
+		for ptype, fields := range filter {
+			for j, m := range fields {
+				if !m.isAny() && j >= a.columnCount {
+					return nil, fmt.Errorf("%w: filter should not exceed %d values", ErrTooManyFields, a.columnCount)
+				}
+			}
+			ptypes[i] = append(ptypes[i], ptype)
+		}
+		sort.Strings(ptypes[i])
+	}
+
+	return query.WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+		q = q.Where("1 = 0")
+		for i, filter := range filters {
+			for _, ptype := range ptypes[i] {
+				fields := filter[ptype]
+				q = q.WhereGroup(" OR ", func(q *bun.SelectQuery) *bun.SelectQuery {
+					q = q.Where("ptype = ?", ptype)
+					for j, m := range fields {
+						q = m.appendQuery(q, valueColumn(j))
+					}
+
+					return q
+				})
+			}
+		}
+
+		return q
+	}), nil
+}
+
+// filterShape describes filters without their values, e.g. "p(in,any,prefix) g(not empty)",
+// filters are separated by " | ".
+func filterShape(filters ...map[string][]Matcher) string {
+	shapes := make([]string, 0, len(filters))
+	for _, filter := range filters {
+		ptypes := make([]string, 0, len(filter))
+		for ptype := range filter {
+			ptypes = append(ptypes, ptype)
+		}
+		sort.Strings(ptypes)
+
+		for i, ptype := range ptypes {
+			ops := make([]string, len(filter[ptype]))
+			for j, m := range filter[ptype] {
+				ops[j] = m.op.String()
+				if m.negate {
+					ops[j] = "not " + ops[j]
+				}
+			}
+			ptypes[i] = ptype + "(" + strings.Join(ops, ",") + ")"
+		}
+		shapes = append(shapes, strings.Join(ptypes, " "))
+	}
+
+	return strings.Join(shapes, " | ")
+}
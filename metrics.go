@@ -0,0 +1,90 @@
+package bunadapter
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metrics are the Prometheus collectors of WithMetrics, labeled with the policy table and the operation.
+type metrics struct {
+	operations *prometheus.CounterVec
+	duration   *prometheus.HistogramVec
+	rules      *prometheus.CounterVec
+	affected   *prometheus.CounterVec
+}
+
+func newMetrics(reg prometheus.Registerer) (*metrics, error) {
+	m := &metrics{
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "casbin_adapter",
+			Name:      "operations_total",
+			Help:      "Policy operations by result.",
+		}, []string{"table", "operation", "result"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "casbin_adapter",
+			Name:      "operation_duration_seconds",
+			Help:      "Duration of policy operations.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"table", "operation"}),
+		rules: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "casbin_adapter",
+			Name:      "rules_total",
+			Help:      "Policy rules loaded by load operations or passed to write operations.",
+		}, []string{"table", "operation"}),
+		affected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "casbin_adapter",
+			Name:      "rows_affected_total",
+			Help:      "Policy rows written or deleted.",
+		}, []string{"table", "operation"}),
+	}
+
+	operations, err := register(reg, m.operations)
+	if err != nil {
+		return nil, err
+	}
+	duration, err := register(reg, m.duration)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := register(reg, m.rules)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := register(reg, m.affected)
+	if err != nil {
+		return nil, err
+	}
+
+	m.operations = operations.(*prometheus.CounterVec)
+	m.duration = duration.(*prometheus.HistogramVec)
+	m.rules = rules.(*prometheus.CounterVec)
+	m.affected = affected.(*prometheus.CounterVec)
+
+	return m, nil
+}
+
+// register registers the collector, adapters sharing a registerer share the collectors registered first.
+func register(reg prometheus.Registerer, c prometheus.Collector) (prometheus.Collector, error) {
+	err := reg.Register(c)
+
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		return are.ExistingCollector, nil
+	}
+
+	return c, err
+}
+
+func (m *metrics) observe(table string, op *operation, d time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+
+	m.operations.WithLabelValues(table, op.name, result).Inc()
+	m.duration.WithLabelValues(table, op.name).Observe(d.Seconds())
+	m.rules.WithLabelValues(table, op.name).Add(float64(op.rules))
+	m.affected.WithLabelValues(table, op.name).Add(float64(op.affected))
+}
@@ -0,0 +1,539 @@
+package bunadapter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mmcloughlin/meow"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/migrate"
+)
+
+// Migrate creates the schema and the policy table if missing and applies pending migrations.
+// It is called by NewAdapter when WithAutoMigrate is used.
+func (a *Adapter) Migrate(ctx context.Context) (err error) {
+	ctx, op := a.startOp(ctx, "Migrate", "")
+	defer a.endOp(op, &err)
+
+	if err := a.createSchema(ctx); err != nil {
+		return fmt.Errorf("failed to create schema: %w", err)
+	}
+
+	migrator := migrate.NewMigrator(a.db, a.migrations(),
+		migrate.WithTableName(a.formatTable(a.tableName+"_migrations")),
+		migrate.WithLocksTableName(a.formatTable(a.tableName+"_migration_locks")),
+	)
+
+	if err := migrator.Init(ctx); err != nil {
+		return fmt.Errorf("failed to create migration tables: %w", err)
+	}
+
+	group, err := migrator.Migrate(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to apply migrations: %w", err)
+	}
+	if !group.IsZero() {
+		a.logger.Info("applied adapter migrations", "table", a.tableName, "migrations", group.Migrations.String())
+	}
+
+	return nil
+}
+
+// migrations returns the versioned migrations of the policy table.
+// Released migrations must never change, add a new one instead.
+func (a *Adapter) migrations() *migrate.Migrations {
+	migrations := migrate.NewMigrations()
+
+	migrations.Add(migrate.Migration{
+		Name: "20230601000000_create_rules_table",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			_, err := db.NewCreateTable().
+				Model((*casbinRuleV1)(nil)).
+				ModelTableExpr("?", a.table()).
+				IfNotExists().
+				Exec(ctx)
+
+			return err
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			_, err := db.NewDropTable().
+				Model((*CasbinRule)(nil)).
+				ModelTableExpr("?", a.table()).
+				IfExists().
+				Exec(ctx)
+
+			return err
+		},
+	})
+
+	migrations.Add(migrate.Migration{
+		Name: "20230601000001_create_rules_indexes",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			if err := a.createIndex(ctx, db, a.tableName, "ptype_v0_idx", "ptype", "v0"); err != nil {
+				return err
+			}
+
+			return a.createIndex(ctx, db, a.tableName, "ptype_v1_idx", "ptype", "v1")
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			if err := a.dropIndex(ctx, db, a.tableName, "ptype_v0_idx"); err != nil {
+				return err
+			}
+
+			return a.dropIndex(ctx, db, a.tableName, "ptype_v1_idx")
+		},
+	})
+
+	migrations.Add(migrate.Migration{
+		Name: "20230601000002_add_value_columns",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			for i := 6; i < 10; i++ {
+				exists, err := a.columnExists(ctx, db, a.tableName, valueColumn(i))
+				if err != nil {
+					return err
+				}
+				if exists {
+					continue
+				}
+
+				_, err = db.NewAddColumn().
+					Model((*CasbinRule)(nil)).
+					ModelTableExpr("?", a.table()).
+					ColumnExpr("? VARCHAR", bun.Ident(valueColumn(i))).
+					Exec(ctx)
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			for i := 6; i < 10; i++ {
+				_, err := db.NewDropColumn().
+					Model((*CasbinRule)(nil)).
+					ModelTableExpr("?", a.table()).
+					ColumnExpr("?", bun.Ident(valueColumn(i))).
+					Exec(ctx)
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	})
+
+	migrations.Add(migrate.Migration{
+		Name: "20230601000003_add_field_count_column",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			exists, err := a.columnExists(ctx, db, a.tableName, "field_count")
+			if err != nil || exists {
+				return err
+			}
+
+			_, err = db.NewAddColumn().
+				Model((*CasbinRule)(nil)).
+				ModelTableExpr("?", a.table()).
+				ColumnExpr("? INTEGER NOT NULL DEFAULT 0", bun.Ident("field_count")).
+				Exec(ctx)
+
+			return err
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			_, err := db.NewDropColumn().
+				Model((*CasbinRule)(nil)).
+				ModelTableExpr("?", a.table()).
+				ColumnExpr("?", bun.Ident("field_count")).
+				Exec(ctx)
+
+			return err
+		},
+	})
+
+	migrations.Add(migrate.Migration{
+		Name: "20230601000004_create_changes_table",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			_, err := db.NewCreateTable().
+				Model((*changeV1)(nil)).
+				ModelTableExpr("?", a.changesTable()).
+				IfNotExists().
+				Exec(ctx)
+
+			return err
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			_, err := db.NewDropTable().
+				Model((*changeV1)(nil)).
+				ModelTableExpr("?", a.changesTable()).
+				IfExists().
+				Exec(ctx)
+
+			return err
+		},
+	})
+
+	migrations.Add(migrate.Migration{
+		Name: "20230601000005_create_audit_table",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			_, err := db.NewCreateTable().
+				Model((*auditEntryV1)(nil)).
+				ModelTableExpr("?", a.auditTable()).
+				IfNotExists().
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+
+			table := a.tableName + "_audit"
+			if err := a.createIndex(ctx, db, table, "old_subject_idx", "old_subject"); err != nil {
+				return err
+			}
+			if err := a.createIndex(ctx, db, table, "new_subject_idx", "new_subject"); err != nil {
+				return err
+			}
+			if err := a.createIndex(ctx, db, table, "old_object_idx", "old_object"); err != nil {
+				return err
+			}
+
+			return a.createIndex(ctx, db, table, "new_object_idx", "new_object")
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			_, err := db.NewDropTable().
+				Model((*auditEntryV1)(nil)).
+				ModelTableExpr("?", a.auditTable()).
+				IfExists().
+				Exec(ctx)
+
+			return err
+		},
+	})
+
+	migrations.Add(migrate.Migration{
+		Name: "20230601000006_create_snapshot_tables",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			_, err := db.NewCreateTable().
+				Model((*snapshotV1)(nil)).
+				ModelTableExpr("?", a.snapshotsTable()).
+				IfNotExists().
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+
+			_, err = db.NewCreateTable().
+				Model((*snapshotRuleV1)(nil)).
+				ModelTableExpr("?", a.snapshotRulesTable()).
+				IfNotExists().
+				Exec(ctx)
+
+			return err
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			_, err := db.NewDropTable().
+				Model((*snapshotRuleV1)(nil)).
+				ModelTableExpr("?", a.snapshotRulesTable()).
+				IfExists().
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+
+			_, err = db.NewDropTable().
+				Model((*snapshotV1)(nil)).
+				ModelTableExpr("?", a.snapshotsTable()).
+				IfExists().
+				Exec(ctx)
+
+			return err
+		},
+	})
+
+	migrations.Add(migrate.Migration{
+		Name: "20230601000007_rehash_rule_ids",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+				return a.rehashRules(ctx, tx)
+			})
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			// The previous IDs were ambiguous, rules keep their new ones.
+			return nil
+		},
+	})
+
+	migrations.Add(migrate.Migration{
+		Name: "20230601000008_create_changes_lock_table",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			_, err := db.NewCreateTable().
+				Model((*changeLockV1)(nil)).
+				ModelTableExpr("?", a.changesLockTable()).
+				IfNotExists().
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+
+			_, err = db.NewInsert().
+				Model(&changeLockV1{ID: 1}).
+				ModelTableExpr("?", a.changesLockTable()).
+				Exec(ctx)
+
+			return err
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			_, err := db.NewDropTable().
+				Model((*changeLockV1)(nil)).
+				ModelTableExpr("?", a.changesLockTable()).
+				IfExists().
+				Exec(ctx)
+
+			return err
+		},
+	})
+
+	migrations.Add(migrate.Migration{
+		Name: "20230601000009_sync_changes_lock_version",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			// Sequence numbers used to be assigned by the change log table, continue after the last one.
+			return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+				var seq int64
+
+				err := tx.NewSelect().
+					ModelTableExpr("?", a.changesTable()).
+					ColumnExpr("COALESCE(MAX(seq), 0)").
+					Scan(ctx, &seq)
+				if err != nil {
+					return err
+				}
+
+				_, err = tx.NewUpdate().
+					TableExpr("?", a.changesLockTable()).
+					Set("version = ?", seq).
+					Where("id = 1").
+					Where("version < ?", seq).
+					Exec(ctx)
+
+				return err
+			})
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			return nil
+		},
+	})
+
+	return migrations
+}
+
+// rehashRules replaces the IDs HashIDStrategy generated before it length-prefixed values with its current ones.
+// It does not depend on WithIDStrategy: other IDs, e.g. of a custom strategy, are kept.
+// Rules whose new ID is taken by an equal rule are duplicates and deleted.
+func (a *Adapter) rehashRules(ctx context.Context, db bun.IDB) error {
+	var lines []*CasbinRule
+
+	// All value columns, rules may have more values than the configured column count.
+	err := db.NewSelect().Model(&lines).ModelTableExpr("? AS ?", a.table(), bun.Ident(a.tableAlias)).Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	var stale []*CasbinRule
+
+	ids := make(map[string]struct{}, len(lines))
+	for _, line := range lines {
+		if line.ID == commaHashID(line.Ptype, line.values()) {
+			stale = append(stale, line)
+		} else {
+			ids[line.ID] = struct{}{}
+		}
+	}
+
+	for _, line := range stale {
+		id := HashIDStrategy(line.Ptype, line.values())
+		if _, ok := ids[id]; ok {
+			_, err = a.newDelete(db, (*CasbinRule)(nil)).Where("id = ?", line.ID).Exec(ctx)
+		} else {
+			ids[id] = struct{}{}
+			_, err = db.NewUpdate().
+				TableExpr("?", a.table()).
+				Set("id = ?", id).
+				Where("id = ?", line.ID).
+				Exec(ctx)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(stale) > 0 {
+		a.logger.Info("rehashed policy rule ids", "table", a.tableName, "rules", len(stale))
+	}
+
+	return nil
+}
+
+// commaHashID is HashIDStrategy before values were length-prefixed, it joined them with commas.
+func commaHashID(ptype string, rule []string) string {
+	data := strings.Join(append([]string{ptype}, rule...), ",")
+
+	return fmt.Sprintf("%x", meow.Checksum(0, []byte(data)))
+}
+
+// casbinRuleV1 is the policy table as created by the first migration.
+type casbinRuleV1 struct {
+	ID    string `bun:",pk"`
+	Ptype string
+	V0    string
+	V1    string
+	V2    string
+	V3    string
+	V4    string
+	V5    string
+}
+
+// changeV1 is the change log table as created by its first migration.
+type changeV1 struct {
+	Seq       int64 `bun:",pk,autoincrement"`
+	Op        string
+	Ptype     string
+	Rule      []string
+	CreatedAt time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+// changeLockV1 is the change log lock table as created by its first migration, it has a single row.
+type changeLockV1 struct {
+	ID      int64 `bun:",pk"`
+	Version int64 `bun:",notnull"`
+}
+
+// auditEntryV1 is the audit history table as created by its first migration.
+type auditEntryV1 struct {
+	ID         int64 `bun:",pk,autoincrement"`
+	Op         string
+	Ptype      string
+	OldRule    []string
+	NewRule    []string
+	OldSubject string
+	OldObject  string
+	NewSubject string
+	NewObject  string
+	Actor      string
+	CreatedAt  time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+// snapshotV1 is the snapshot table as created by its first migration.
+type snapshotV1 struct {
+	ID        int64 `bun:",pk,autoincrement"`
+	Label     string
+	RuleCount int       `bun:",notnull"`
+	CreatedAt time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+// snapshotRuleV1 is the snapshot rule table as created by its first migration.
+type snapshotRuleV1 struct {
+	SnapshotID int64  `bun:",pk"`
+	ID         string `bun:",pk"`
+	Ptype      string
+	V0         string
+	V1         string
+	V2         string
+	V3         string
+	V4         string
+	V5         string
+	V6         string
+	V7         string
+	V8         string
+	V9         string
+	FieldCount int `bun:",notnull"`
+}
+
+func (a *Adapter) createSchema(ctx context.Context) error {
+	if a.schema == "" {
+		return nil
+	}
+
+	switch a.db.Dialect().Name() {
+	case dialect.SQLite:
+		// SQLite has no schemas, they are attached databases.
+		return nil
+	default:
+		_, err := a.db.ExecContext(ctx, "CREATE SCHEMA IF NOT EXISTS ?", bun.Ident(a.schema))
+
+		return err
+	}
+}
+
+func (a *Adapter) createIndex(ctx context.Context, db *bun.DB, table, name string, columns ...string) error {
+	query := db.NewCreateIndex().Model((*CasbinRule)(nil)).Column(columns...)
+
+	switch db.Dialect().Name() {
+	case dialect.SQLite:
+		// SQLite qualifies the index name instead of the table name.
+		query = query.IfNotExists().IndexExpr("?", a.qualify(table+"_"+name)).ModelTableExpr("?", bun.Ident(table))
+	default:
+		query = query.IfNotExists().IndexExpr("?", bun.Ident(table+"_"+name)).ModelTableExpr("?", a.qualify(table))
+	}
+
+	_, err := query.Exec(ctx)
+
+	return err
+}
+
+func (a *Adapter) dropIndex(ctx context.Context, db *bun.DB, table, name string) error {
+	_, err := db.NewDropIndex().Index("?", a.qualify(table+"_"+name)).IfExists().Exec(ctx)
+
+	return err
+}
+
+// columnExists reports whether the table has the column, tables created from CasbinRule have all of them.
+func (a *Adapter) columnExists(ctx context.Context, db *bun.DB, table, column string) (bool, error) {
+	var n int
+
+	if db.Dialect().Name() == dialect.SQLite {
+		query := db.NewSelect().ColumnExpr("COUNT(*)").Where("name = ?", column)
+		if a.schema != "" {
+			query = query.TableExpr("pragma_table_info(?, ?)", table, a.schema)
+		} else {
+			query = query.TableExpr("pragma_table_info(?)", table)
+		}
+		err := query.Scan(ctx, &n)
+
+		return n > 0, err
+	}
+
+	query := db.NewSelect().
+		TableExpr("INFORMATION_SCHEMA.COLUMNS").
+		ColumnExpr("COUNT(*)").
+		Where("TABLE_NAME = ?", table).
+		Where("COLUMN_NAME = ?", column)
+	if a.schema != "" {
+		query = query.Where("TABLE_SCHEMA = ?", a.schema)
+	} else {
+		query = query.Where("TABLE_SCHEMA = CURRENT_SCHEMA()")
+	}
+	err := query.Scan(ctx, &n)
+
+	return n > 0, err
+}
+
+// qualify prefixes name with the configured schema.
+func (a *Adapter) qualify(name string) bun.Ident {
+	if a.schema == "" {
+		return bun.Ident(name)
+	}
+
+	return bun.Ident(a.schema + "." + name)
+}
+
+// qualifiedName returns the unquoted, schema-qualified name of the policy table, e.g. casbin.casbin_rules.
+func (a *Adapter) qualifiedName() string {
+	return string(a.qualify(a.tableName))
+}
+
+// formatTable returns the quoted, schema-qualified name of an adapter table.
+func (a *Adapter) formatTable(name string) string {
+	return a.db.Formatter().FormatQuery("?", a.qualify(name))
+}
@@ -0,0 +1,117 @@
+package bunadapter
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Level is the level of operation log records, it has the values of slog.Level.
+type Level int
+
+// Log levels.
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+// operation is a running adapter method, it is reported when the method returns.
+type operation struct {
+	name  string
+	ptype string
+	// rules is the number of rules passed to a write or loaded by a load.
+	rules int
+	// affected is the number of rows written or deleted.
+	affected int64
+	// matched is the number of rows matched by each old rule of an update.
+	matched []int
+	// load is set by operations loading a policy into a model, filtered by those loading a filtered policy.
+	load, filtered bool
+	// filter is the shape of the filter of a filtered load, see filterShape.
+	filter string
+	start  time.Time
+	cancel context.CancelFunc
+	span   trace.Span
+}
+
+type operationKey struct{}
+
+// startOp starts the named operation and applies the query timeout to ctx, end it with endOp.
+func (a *Adapter) startOp(ctx context.Context, name, ptype string) (context.Context, *operation) {
+	op := &operation{name: name, ptype: ptype, start: time.Now()}
+	ctx = a.startSpan(context.WithValue(ctx, operationKey{}, op), op)
+	ctx, op.cancel = a.withTimeout(ctx)
+
+	return ctx, op
+}
+
+// endOp ends the operation with the error returned by its method, defer it with a pointer to the named result.
+func (a *Adapter) endOp(op *operation, err *error) {
+	op.cancel()
+
+	d := time.Since(op.start)
+	a.logOp(op, d, *err)
+	if a.metrics != nil {
+		a.metrics.observe(a.qualifiedName(), op, d, *err)
+	}
+	a.endSpan(op, *err)
+}
+
+// addAffected adds the rows affected by a statement to the operation running with ctx.
+func addAffected(ctx context.Context, res sql.Result) {
+	op, ok := ctx.Value(operationKey{}).(*operation)
+	if !ok || res == nil {
+		return
+	}
+
+	if n, err := res.RowsAffected(); err == nil {
+		op.affected += n
+	}
+}
+
+// addMatched records the rows matched by an old rule of the update running with ctx.
+func addMatched(ctx context.Context, n int) {
+	if op, ok := ctx.Value(operationKey{}).(*operation); ok {
+		op.matched = append(op.matched, n)
+	}
+}
+
+func (a *Adapter) logOp(op *operation, d time.Duration, err error) {
+	if !a.opLog {
+		return
+	}
+
+	args := []interface{}{"operation", op.name}
+	if op.ptype != "" {
+		args = append(args, "ptype", op.ptype)
+	}
+	args = append(args, "rules", op.rules)
+	if op.matched != nil {
+		args = append(args, "matched", op.matched)
+	}
+	args = append(args, "duration", d)
+
+	if err != nil {
+		a.log(a.opErrorLevel, "adapter operation failed", append(args, "error", err)...)
+
+		return
+	}
+	a.log(a.opLevel, "adapter operation", args...)
+}
+
+func (a *Adapter) log(level Level, msg string, args ...interface{}) {
+	switch {
+	case level < LevelInfo:
+		a.logger.Debug(msg, args...)
+	case level < LevelWarn:
+		a.logger.Info(msg, args...)
+	case level < LevelError:
+		a.logger.Warn(msg, args...)
+	default:
+		a.logger.Error(msg, args...)
+	}
+}
@@ -0,0 +1,217 @@
+package bunadapter
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/uptrace/bun/driver/pgdriver"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Option configures the Adapter.
+type Option func(a *Adapter) error
+
+// WithSchema sets the database schema of the policy table.
+// An empty schema leaves the table name unqualified.
+// Defaults to "casbin".
+func WithSchema(schema string) Option {
+	return func(a *Adapter) error {
+		a.schema = schema
+
+		return nil
+	}
+}
+
+// WithTableName sets the name of the policy table.
+// Defaults to "casbin_rules".
+func WithTableName(name string) Option {
+	return func(a *Adapter) error {
+		if name == "" {
+			return errors.New("table name must not be empty")
+		}
+		a.tableName = name
+
+		return nil
+	}
+}
+
+// WithTableAlias sets the alias of the policy table used in queries.
+// Defaults to "cr".
+func WithTableAlias(alias string) Option {
+	return func(a *Adapter) error {
+		if alias == "" {
+			return errors.New("table alias must not be empty")
+		}
+		a.tableAlias = alias
+
+		return nil
+	}
+}
+
+// WithColumnCount sets the number of value columns (v0, v1, ...) the adapter reads and writes.
+// Defaults to 6.
+func WithColumnCount(n int) Option {
+	return func(a *Adapter) error {
+		if n < 1 || n > maxColumnCount {
+			return fmt.Errorf("column count must be between 1 and %d, got %d", maxColumnCount, n)
+		}
+		a.columnCount = n
+
+		return nil
+	}
+}
+
+// WithAutoMigrate makes NewAdapter create the schema, the policy table and its indexes
+// if they do not exist and apply pending migrations, see Adapter.Migrate.
+func WithAutoMigrate() Option {
+	return func(a *Adapter) error {
+		a.autoMigrate = true
+
+		return nil
+	}
+}
+
+// WithChangeLog makes the adapter record every policy change in the <table>_changes table,
+// in the transaction of the change, see Adapter.LoadChanges.
+// Enable it on every instance writing to the policy table.
+func WithChangeLog() Option {
+	return func(a *Adapter) error {
+		a.changeLog = true
+
+		return nil
+	}
+}
+
+// WithAudit makes the adapter record every change in the <table>_audit history table,
+// in the transaction of the change, see Adapter.AuditHistory and ContextWithActor.
+func WithAudit() Option {
+	return func(a *Adapter) error {
+		a.audit = true
+
+		return nil
+	}
+}
+
+// WithCopyFrom makes SavePolicy and AddPolicies write rules with Postgres COPY instead of multi-row inserts.
+// It requires the pgdriver driver.
+func WithCopyFrom() Option {
+	return func(a *Adapter) error {
+		if _, ok := a.db.Driver().(pgdriver.Driver); !ok {
+			return errors.New("copy requires the pgdriver driver")
+		}
+		a.copyFrom = true
+
+		return nil
+	}
+}
+
+// WithLogger sets the logger used by the adapter. *slog.Logger satisfies the Logger interface.
+// By default nothing is logged.
+func WithLogger(logger Logger) Option {
+	return func(a *Adapter) error {
+		if logger == nil {
+			return errors.New("logger must not be nil")
+		}
+		a.logger = logger
+
+		return nil
+	}
+}
+
+// WithOperationLog makes the adapter log every policy operation with its ptype, rule count and duration
+// to the logger of WithLogger, at level when it succeeds and at errorLevel with the error when it fails.
+func WithOperationLog(level, errorLevel Level) Option {
+	return func(a *Adapter) error {
+		a.opLog = true
+		a.opLevel = level
+		a.opErrorLevel = errorLevel
+
+		return nil
+	}
+}
+
+// WithMetrics registers Prometheus metrics of the policy operations with reg: operation counts by result,
+// durations, and the number of rules and affected rows. Adapters may share reg.
+func WithMetrics(reg prometheus.Registerer) Option {
+	return func(a *Adapter) error {
+		if reg == nil {
+			return errors.New("metrics registerer must not be nil")
+		}
+
+		m, err := newMetrics(reg)
+		if err != nil {
+			return fmt.Errorf("failed to register metrics: %w", err)
+		}
+		a.metrics = m
+
+		return nil
+	}
+}
+
+// WithTracing makes the adapter start a span per policy operation with the provider, a nil provider
+// uses the global one. The spans are the parents of the query spans, e.g. of bunotel.
+func WithTracing(provider trace.TracerProvider) Option {
+	return func(a *Adapter) error {
+		if provider == nil {
+			provider = otel.GetTracerProvider()
+		}
+		a.tracer = provider.Tracer(instrumentationName)
+
+		return nil
+	}
+}
+
+// WithIDStrategy sets the function generating rule primary keys.
+// The function must be deterministic. Defaults to HashIDStrategy.
+func WithIDStrategy(strategy IDStrategy) Option {
+	return func(a *Adapter) error {
+		if strategy == nil {
+			return errors.New("id strategy must not be nil")
+		}
+		a.idStrategy = strategy
+
+		return nil
+	}
+}
+
+// WithBatchSize sets the maximum number of rules written or deleted by a single statement.
+// Defaults to 1000.
+func WithBatchSize(n int) Option {
+	return func(a *Adapter) error {
+		if n < 1 {
+			return fmt.Errorf("batch size must be positive, got %d", n)
+		}
+		a.batchSize = n
+
+		return nil
+	}
+}
+
+// WithPageSize sets the number of rules loaded per query, policies are loaded in pages ordered by ID.
+// Zero loads all rules with a single query. Defaults to 10000.
+func WithPageSize(n int) Option {
+	return func(a *Adapter) error {
+		if n < 0 {
+			return fmt.Errorf("page size must not be negative, got %d", n)
+		}
+		a.pageSize = n
+
+		return nil
+	}
+}
+
+// WithQueryTimeout sets the timeout applied to every adapter operation.
+// Zero disables the timeout, which is the default.
+func WithQueryTimeout(d time.Duration) Option {
+	return func(a *Adapter) error {
+		if d < 0 {
+			return fmt.Errorf("query timeout must not be negative, got %s", d)
+		}
+		a.queryTimeout = d
+
+		return nil
+	}
+}
@@ -0,0 +1,157 @@
+package bunadapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/uptrace/bun"
+)
+
+// ErrSnapshotNotFound is returned for unknown snapshot IDs.
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// Snapshot is a saved copy of the policy rules.
+type Snapshot struct {
+	ID        int64 `bun:",pk,autoincrement"`
+	Label     string
+	RuleCount int
+	CreatedAt time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+// Snapshot copies the current policy rules into a new snapshot with the label.
+func (a *Adapter) Snapshot(ctx context.Context, label string) (_ *Snapshot, err error) {
+	ctx, op := a.startOp(ctx, "Snapshot", "")
+	defer a.endOp(op, &err)
+
+	snapshot := &Snapshot{Label: label}
+
+	err = a.runInTx(ctx, func(ctx context.Context, tx bun.IDB) error {
+		_, err := tx.NewInsert().Model(snapshot).ModelTableExpr("?", a.snapshotsTable()).Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		columns := a.columnIdents()
+		res, err := tx.ExecContext(ctx, "INSERT INTO ? (snapshot_id, ?) SELECT ?, ? FROM ?",
+			a.snapshotRulesTable(), bun.In(columns), snapshot.ID, bun.In(columns), a.table())
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		snapshot.RuleCount = int(n)
+		op.rules = snapshot.RuleCount
+
+		_, err = tx.NewUpdate().
+			TableExpr("?", a.snapshotsTable()).
+			Set("rule_count = ?", snapshot.RuleCount).
+			Where("id = ?", snapshot.ID).
+			Exec(ctx)
+
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create policy snapshot: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+// ListSnapshots returns the saved snapshots, oldest first.
+func (a *Adapter) ListSnapshots(ctx context.Context) (_ []*Snapshot, err error) {
+	ctx, op := a.startOp(ctx, "ListSnapshots", "")
+	defer a.endOp(op, &err)
+
+	var snapshots []*Snapshot
+
+	err = a.idb().NewSelect().
+		Model(&snapshots).
+		ModelTableExpr("? AS ?", a.snapshotsTable(), bun.Ident("snapshot")).
+		Order("id").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list policy snapshots: %w", err)
+	}
+
+	return snapshots, nil
+}
+
+// LoadSnapshot loads the policy rules of the snapshot into the model.
+func (a *Adapter) LoadSnapshot(ctx context.Context, model model.Model, id int64) (err error) {
+	ctx, op := a.startOp(ctx, "LoadSnapshot", "")
+	defer a.endOp(op, &err)
+	op.load = true
+
+	lines, err := a.snapshotRules(ctx, a.idb(), id)
+	if err != nil {
+		return fmt.Errorf("failed to load policy snapshot: %w", err)
+	}
+	op.rules = len(lines)
+
+	a.loadRules(model, lines)
+
+	return nil
+}
+
+// RestoreSnapshot atomically replaces the policy rules with the rules of the snapshot.
+func (a *Adapter) RestoreSnapshot(ctx context.Context, id int64) (err error) {
+	ctx, op := a.startOp(ctx, "RestoreSnapshot", "")
+	defer a.endOp(op, &err)
+
+	err = a.runInTx(ctx, func(ctx context.Context, tx bun.IDB) error {
+		lines, err := a.snapshotRules(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		op.rules = len(lines)
+
+		return a.saveRules(ctx, tx, true, lines...)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to restore policy snapshot: %w", err)
+	}
+
+	return nil
+}
+
+func (a *Adapter) snapshotRules(ctx context.Context, db bun.IDB, id int64) ([]*CasbinRule, error) {
+	exists, err := db.NewSelect().
+		ModelTableExpr("?", a.snapshotsTable()).
+		Where("id = ?", id).
+		Exists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %d", ErrSnapshotNotFound, id)
+	}
+
+	var lines []*CasbinRule
+
+	err = a.newSelectFrom(db, &lines, a.snapshotRulesTable()).
+		Where("?.snapshot_id = ?", bun.Ident(a.tableAlias), id).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Snapshots taken before the ID strategy changed keep the previous IDs.
+	for _, line := range lines {
+		line.ID = a.idStrategy(line.Ptype, line.values())
+	}
+
+	return lines, nil
+}
+
+func (a *Adapter) snapshotsTable() bun.Ident {
+	return a.qualify(a.tableName + "_snapshots")
+}
+
+func (a *Adapter) snapshotRulesTable() bun.Ident {
+	return a.qualify(a.tableName + "_snapshot_rules")
+}
@@ -0,0 +1,54 @@
+package bunadapter
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/msales/casbin-bun-adapter"
+
+// startSpan starts the span of the operation, the queries of the operation become its children.
+func (a *Adapter) startSpan(ctx context.Context, op *operation) context.Context {
+	if a.tracer == nil {
+		return ctx
+	}
+
+	attrs := []attribute.KeyValue{attribute.String("db.sql.table", a.qualifiedName())}
+	if op.ptype != "" {
+		attrs = append(attrs, attribute.String("casbin.ptype", op.ptype))
+	}
+
+	ctx, op.span = a.tracer.Start(ctx, "casbin."+op.name, trace.WithAttributes(attrs...))
+
+	return ctx
+}
+
+// endSpan ends the span of the operation with its results.
+func (a *Adapter) endSpan(op *operation, err error) {
+	if op.span == nil {
+		return
+	}
+
+	op.span.SetAttributes(
+		attribute.Int("casbin.rules", op.rules),
+		attribute.Int64("casbin.rows_affected", op.affected),
+	)
+	if op.load {
+		op.span.SetAttributes(attribute.Bool("casbin.filtered", op.filtered))
+	}
+	if op.matched != nil {
+		op.span.SetAttributes(attribute.IntSlice("casbin.rows_matched", op.matched))
+	}
+	if op.filter != "" {
+		op.span.SetAttributes(attribute.String("casbin.filter", op.filter))
+	}
+	if err != nil {
+		op.span.RecordError(err)
+		op.span.SetStatus(codes.Error, err.Error())
+	}
+
+	op.span.End()
+}
@@ -0,0 +1,338 @@
+package bunadapter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+var (
+	_ persist.Watcher   = (*Watcher)(nil)
+	_ persist.WatcherEx = (*Watcher)(nil)
+)
+
+const (
+	defaultWatcherChannel = "casbin"
+
+	// maxPayloadSize is the Postgres limit of a NOTIFY payload.
+	maxPayloadSize = 8000
+)
+
+// UpdateType is the kind of policy change announced by a WatcherMessage.
+type UpdateType string
+
+// Policy change kinds.
+const (
+	Update                        UpdateType = "Update"
+	UpdateForAddPolicy            UpdateType = "UpdateForAddPolicy"
+	UpdateForRemovePolicy         UpdateType = "UpdateForRemovePolicy"
+	UpdateForRemoveFilteredPolicy UpdateType = "UpdateForRemoveFilteredPolicy"
+	UpdateForSavePolicy           UpdateType = "UpdateForSavePolicy"
+	UpdateForAddPolicies          UpdateType = "UpdateForAddPolicies"
+	UpdateForRemovePolicies       UpdateType = "UpdateForRemovePolicies"
+)
+
+// WatcherMessage is the JSON payload of a policy change notification.
+type WatcherMessage struct {
+	Method      UpdateType `json:"method"`
+	ID          string     `json:"id"`
+	Sec         string     `json:"sec,omitempty"`
+	Ptype       string     `json:"ptype,omitempty"`
+	FieldIndex  int        `json:"field_index,omitempty"`
+	FieldValues []string   `json:"field_values,omitempty"`
+	Rules       [][]string `json:"rules,omitempty"`
+}
+
+// WatcherOption configures the Watcher.
+type WatcherOption func(w *Watcher) error
+
+// WithChannel sets the Postgres notification channel.
+// Defaults to "casbin".
+func WithChannel(channel string) WatcherOption {
+	return func(w *Watcher) error {
+		if channel == "" {
+			return errors.New("channel must not be empty")
+		}
+		w.channel = channel
+
+		return nil
+	}
+}
+
+// WithWatcherLogger sets the logger used by the watcher. By default nothing is logged.
+func WithWatcherLogger(logger Logger) WatcherOption {
+	return func(w *Watcher) error {
+		if logger == nil {
+			return errors.New("logger must not be nil")
+		}
+		w.logger = logger
+
+		return nil
+	}
+}
+
+// Watcher synchronizes enforcers of several instances over Postgres LISTEN/NOTIFY.
+// Notifications sent by a watcher are not delivered to its own callback.
+type Watcher struct {
+	db       *bun.DB
+	listener *pgdriver.Listener
+	channel  string
+	id       string
+	logger   Logger
+
+	mu       sync.RWMutex
+	callback func(string)
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// NewWatcher returns a watcher listening on the Postgres channel, db must use the pgdriver driver.
+func NewWatcher(ctx context.Context, db *bun.DB, opts ...WatcherOption) (*Watcher, error) {
+	if db == nil {
+		return nil, errors.New("db must not be nil")
+	}
+	if _, ok := db.Driver().(pgdriver.Driver); !ok {
+		return nil, errors.New("watcher requires the pgdriver driver")
+	}
+
+	w := &Watcher{
+		db:      db,
+		channel: defaultWatcherChannel,
+		id:      uuid.NewString(),
+		logger:  nopLogger{},
+		done:    make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		if err := opt(w); err != nil {
+			return nil, fmt.Errorf("invalid watcher option: %w", err)
+		}
+	}
+
+	w.listener = pgdriver.NewListener(db)
+	if err := w.listener.Listen(ctx, w.channel); err != nil {
+		_ = w.listener.Close()
+
+		return nil, fmt.Errorf("failed to listen to channel %s: %w", w.channel, err)
+	}
+
+	go w.receive(w.listener.Channel())
+
+	return w, nil
+}
+
+// SetUpdateCallback sets the function called with the JSON WatcherMessage
+// of every change made by other instances, see DefaultUpdateCallback.
+func (w *Watcher) SetUpdateCallback(callback func(string)) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.callback = callback
+
+	return nil
+}
+
+// Update notifies other instances to reload the whole policy.
+func (w *Watcher) Update() error {
+	return w.notify(&WatcherMessage{Method: Update})
+}
+
+// UpdateForAddPolicy notifies other instances of an added rule.
+func (w *Watcher) UpdateForAddPolicy(sec, ptype string, params ...string) error {
+	return w.notify(&WatcherMessage{Method: UpdateForAddPolicy, Sec: sec, Ptype: ptype, Rules: [][]string{params}})
+}
+
+// UpdateForRemovePolicy notifies other instances of a removed rule.
+func (w *Watcher) UpdateForRemovePolicy(sec, ptype string, params ...string) error {
+	return w.notify(&WatcherMessage{Method: UpdateForRemovePolicy, Sec: sec, Ptype: ptype, Rules: [][]string{params}})
+}
+
+// UpdateForRemoveFilteredPolicy notifies other instances of rules removed by a filter.
+func (w *Watcher) UpdateForRemoveFilteredPolicy(sec, ptype string, fieldIndex int, fieldValues ...string) error {
+	return w.notify(&WatcherMessage{
+		Method:      UpdateForRemoveFilteredPolicy,
+		Sec:         sec,
+		Ptype:       ptype,
+		FieldIndex:  fieldIndex,
+		FieldValues: fieldValues,
+	})
+}
+
+// UpdateForSavePolicy notifies other instances to reload the whole policy.
+func (w *Watcher) UpdateForSavePolicy(_ model.Model) error {
+	return w.notify(&WatcherMessage{Method: UpdateForSavePolicy})
+}
+
+// UpdateForAddPolicies notifies other instances of added rules.
+func (w *Watcher) UpdateForAddPolicies(sec string, ptype string, rules ...[]string) error {
+	return w.notify(&WatcherMessage{Method: UpdateForAddPolicies, Sec: sec, Ptype: ptype, Rules: rules})
+}
+
+// UpdateForRemovePolicies notifies other instances of removed rules.
+func (w *Watcher) UpdateForRemovePolicies(sec string, ptype string, rules ...[]string) error {
+	return w.notify(&WatcherMessage{Method: UpdateForRemovePolicies, Sec: sec, Ptype: ptype, Rules: rules})
+}
+
+// Close stops listening, the callback is not called any more.
+func (w *Watcher) Close() {
+	w.closeOnce.Do(func() {
+		if err := w.listener.Close(); err != nil {
+			w.logger.Warn("failed to close watcher listener", "error", err)
+		}
+		<-w.done
+	})
+}
+
+func (w *Watcher) notify(msg *WatcherMessage) error {
+	msg.ID = w.id
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode watcher message: %w", err)
+	}
+	if len(payload) > maxPayloadSize {
+		// Too large for NOTIFY, ask for a full reload instead.
+		payload, err = json.Marshal(&WatcherMessage{Method: Update, ID: w.id})
+		if err != nil {
+			return fmt.Errorf("failed to encode watcher message: %w", err)
+		}
+	}
+
+	if err := pgdriver.Notify(context.Background(), w.db, w.channel, string(payload)); err != nil {
+		return fmt.Errorf("failed to notify channel %s: %w", w.channel, err)
+	}
+
+	return nil
+}
+
+func (w *Watcher) receive(notifications <-chan pgdriver.Notification) {
+	defer close(w.done)
+
+	for n := range notifications {
+		var msg WatcherMessage
+		if err := json.Unmarshal([]byte(n.Payload), &msg); err != nil {
+			w.logger.Warn("failed to decode watcher message", "payload", n.Payload, "error", err)
+			continue
+		}
+		if msg.ID == w.id {
+			continue
+		}
+
+		w.mu.RLock()
+		callback := w.callback
+		w.mu.RUnlock()
+
+		if callback != nil {
+			callback(n.Payload)
+		}
+	}
+}
+
+// DefaultUpdateCallback returns a watcher callback applying incremental changes to the enforcer,
+// other messages and failed changes reload the whole policy. A nil logger discards errors.
+// The changes are stored already, so they are applied to the model only and never written back to the database.
+// The lock of a casbin.SyncedEnforcer is held while the model changes.
+func DefaultUpdateCallback(e casbin.IEnforcer, logger Logger) func(string) {
+	if logger == nil {
+		logger = nopLogger{}
+	}
+
+	return func(payload string) {
+		var msg WatcherMessage
+		if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+			logger.Warn("failed to decode watcher message", "payload", payload, "error", err)
+		} else if err := applyMessage(e, &msg); err == nil {
+			return
+		} else {
+			logger.Warn("failed to apply watcher message", "method", msg.Method, "error", err)
+		}
+
+		if err := e.LoadPolicy(); err != nil {
+			logger.Error("failed to reload policy", "error", err)
+		}
+	}
+}
+
+// roleLinkBuilder is implemented by the casbin enforcers, casbin.IEnforcer lacks the method.
+type roleLinkBuilder interface {
+	BuildIncrementalRoleLinks(op model.PolicyOp, ptype string, rules [][]string) error
+}
+
+func applyMessage(e casbin.IEnforcer, msg *WatcherMessage) error {
+	switch msg.Method {
+	case UpdateForAddPolicy, UpdateForAddPolicies, UpdateForRemovePolicy, UpdateForRemovePolicies, UpdateForRemoveFilteredPolicy:
+	default:
+		return e.LoadPolicy()
+	}
+
+	if de, ok := e.(casbin.IDistributedEnforcer); ok {
+		return applyDistributed(de, msg)
+	}
+
+	// The Self methods of casbin.Enforcer persist the changes, change the model directly.
+	if se, ok := e.(interface{ GetLock() *sync.RWMutex }); ok {
+		mu := se.GetLock()
+		mu.Lock()
+		defer mu.Unlock()
+	}
+
+	return applyToModel(e, msg)
+}
+
+func applyDistributed(de casbin.IDistributedEnforcer, msg *WatcherMessage) error {
+	noPersist := func() bool { return false }
+
+	var err error
+	switch msg.Method {
+	case UpdateForAddPolicy, UpdateForAddPolicies:
+		_, err = de.AddPoliciesSelf(noPersist, msg.Sec, msg.Ptype, msg.Rules)
+	case UpdateForRemovePolicy, UpdateForRemovePolicies:
+		_, err = de.RemovePoliciesSelf(noPersist, msg.Sec, msg.Ptype, msg.Rules)
+	default:
+		_, err = de.RemoveFilteredPolicySelf(noPersist, msg.Sec, msg.Ptype, msg.FieldIndex, msg.FieldValues...)
+	}
+
+	return err
+}
+
+// applyToModel applies the message to the model of e and updates the role links of the changed grouping rules.
+func applyToModel(e casbin.IEnforcer, msg *WatcherMessage) error {
+	m := e.GetModel()
+
+	var (
+		op    model.PolicyOp
+		rules [][]string
+		err   error
+	)
+	switch msg.Method {
+	case UpdateForAddPolicy, UpdateForAddPolicies:
+		op = model.PolicyAdd
+		rules, err = m.AddPoliciesWithAffected(msg.Sec, msg.Ptype, msg.Rules)
+	case UpdateForRemovePolicy, UpdateForRemovePolicies:
+		op = model.PolicyRemove
+		rules, err = m.RemovePoliciesWithAffected(msg.Sec, msg.Ptype, msg.Rules)
+	default:
+		op = model.PolicyRemove
+		_, rules, err = m.RemoveFilteredPolicy(msg.Sec, msg.Ptype, msg.FieldIndex, msg.FieldValues...)
+	}
+	if err != nil || msg.Sec != "g" || len(rules) == 0 {
+		return err
+	}
+
+	b, ok := e.(roleLinkBuilder)
+	if !ok {
+		return fmt.Errorf("enforcer %T cannot update role links incrementally", e)
+	}
+
+	return b.BuildIncrementalRoleLinks(op, msg.Ptype, rules)
+}